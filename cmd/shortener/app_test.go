@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/app"
+	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppLifecycle(t *testing.T) {
+	cfg := config.New()
+	cfg.Address = "127.0.0.1:0"
+	cfg.GRPCAddress = "127.0.0.1:0"
+	cfg.DatabaseDSN = ""
+	cfg.FilePath = filepath.Join(t.TempDir(), "data.json")
+
+	a, err := app.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+
+	baseURL := "http://" + a.Addr().String()
+
+	resp, err := http.Post(baseURL+"/", "text/plain", strings.NewReader("https://vk.com"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.True(t, strings.HasSuffix(string(body), "/XxLlqM"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, a.Shutdown(ctx))
+
+	// Сервер остановлен без ошибок и больше не принимает соединения
+	_, open := <-a.Errors()
+	assert.False(t, open, "Канал ошибок должен быть закрыт после остановки")
+	_, err = http.Get(baseURL + "/XxLlqM")
+	assert.Error(t, err)
+
+	data, err := os.ReadFile(cfg.FilePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "https://vk.com", "Данные должны быть сохранены в файл")
+}
+
+func TestAppHTTPS(t *testing.T) {
+	cfg := config.New()
+	cfg.Address = "127.0.0.1:0"
+	cfg.GRPCAddress = "127.0.0.1:0"
+	cfg.DatabaseDSN = ""
+	cfg.FilePath = ""
+	cfg.EnableHTTPS = true
+	config.Normalize(cfg)
+	require.Equal(t, "https://localhost:8080", cfg.ReturningAddress, "BASE_URL по умолчанию должен использовать https")
+
+	a, err := app.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, a.Shutdown(ctx))
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Сертификат самоподписанный, поэтому имена хостов проверяем вручную ниже
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Post("https://"+a.Addr().String()+"/", "text/plain", strings.NewReader("https://vk.com"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "https://localhost:8080/XxLlqM", string(body))
+	require.NotNil(t, resp.TLS)
+	leaf := resp.TLS.PeerCertificates[0]
+	assert.NoError(t, leaf.VerifyHostname("localhost"))
+	assert.NoError(t, leaf.VerifyHostname("127.0.0.1"))
+
+	// Запросы без TLS сервер отклоняет
+	plain, err := http.Get("http://" + a.Addr().String() + "/XxLlqM")
+	require.NoError(t, err)
+	plain.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, plain.StatusCode)
+}
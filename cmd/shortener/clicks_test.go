@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/models"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetURLStats(t *testing.T) {
+	storage := newFakeStorage(map[string]string{
+		"XxLlqM": "https://vk.com",
+	})
+	handler := setupTestHandler(storage)
+	router := setupTestRouter(handler)
+
+	for _, ip := range []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.2:1000"} {
+		r := httptest.NewRequest(http.MethodGet, "/XxLlqM", nil)
+		r.RemoteAddr = ip
+		r.Header.Set("Referer", "https://example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	t.Run("Test #1 stats of existing link", func(t *testing.T) {
+		var stats models.URLStats
+		assert.Eventually(t, func() bool {
+			r := httptest.NewRequest(http.MethodGet, "/api/urls/XxLlqM/stats", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				return false
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+			return stats.TotalClicks == 3
+		}, 3*time.Second, 50*time.Millisecond, "Переходы должны попасть в статистику")
+
+		assert.Equal(t, int64(2), stats.UniqueVisitors)
+		require.Len(t, stats.Daily, 1)
+		assert.Equal(t, time.Now().UTC().Format(time.DateOnly), stats.Daily[0].Date)
+		assert.Equal(t, int64(3), stats.Daily[0].Clicks)
+	})
+
+	t.Run("Test #2 stats of unknown link", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/urls/FFF113/stats", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusNotFound, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+}
+
+func TestClickStorages(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []dbstorage.ClickEvent{
+		{ShortPath: "abc", Timestamp: day, IPHash: "a"},
+		{ShortPath: "abc", Timestamp: day.Add(time.Hour), IPHash: "a"},
+		{ShortPath: "abc", Timestamp: day.Add(24 * time.Hour), IPHash: "b"},
+		{ShortPath: "other", Timestamp: day, IPHash: "c"},
+	}
+	want := dbstorage.ClickStats{
+		TotalClicks:    3,
+		UniqueVisitors: 2,
+		Daily: []dbstorage.DailyClicks{
+			{Date: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Clicks: 2},
+			{Date: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), Clicks: 1},
+		},
+	}
+
+	t.Run("memory ring", func(t *testing.T) {
+		clicks := dbstorage.NewMemoryClickStorage(10)
+		require.NoError(t, clicks.SaveClicks(ctx, events))
+
+		stats, err := clicks.GetClickStats(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, want, stats)
+
+		// Старые события вытесняются из буфера
+		small := dbstorage.NewMemoryClickStorage(2)
+		require.NoError(t, small.SaveClicks(ctx, events))
+		stats, err = small.GetClickStats(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.TotalClicks)
+	})
+
+	t.Run("file log", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data.json.clicks")
+		clicks, err := dbstorage.NewFileClickStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, clicks.SaveClicks(ctx, events))
+		require.NoError(t, clicks.Close())
+
+		// Имитируем недописанную последнюю строку
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"short_path":"abc","times`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		reopened, err := dbstorage.NewFileClickStorage(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+
+		stats, err := reopened.GetClickStats(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, want, stats)
+
+		// Новые записи не должны склеиваться с поврежденной строкой
+		require.NoError(t, reopened.SaveClicks(ctx, events[:1]))
+		again, err := dbstorage.NewFileClickStorage(path)
+		require.NoError(t, err)
+		defer again.Close()
+
+		stats, err = again.GetClickStats(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), stats.TotalClicks)
+	})
+}
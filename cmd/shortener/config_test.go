@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigLoad(t *testing.T) {
+	t.Run("json file", func(t *testing.T) {
+		path := writeConfigFile(t, "config.json", `{
+			"server_address": "localhost:9090",
+			"base_url": "http://short.example",
+			"short_path_generator": "random",
+			"shutdown_timeout": "3s"
+		}`)
+
+		cfg, err := config.Load([]string{"-c", path})
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:9090", cfg.Address)
+		assert.Equal(t, "http://short.example", cfg.ReturningAddress)
+		assert.Equal(t, "random", cfg.ShortPathGenerator)
+		assert.Equal(t, 3*time.Second, cfg.ShutdownTimeout)
+		assert.Equal(t, "info", cfg.LogLevel)
+	})
+
+	t.Run("yaml file from env", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "server_address: localhost:9091\nexpiry_sweep_interval: 30s\ndb_query_timeout: 2s\n")
+		t.Setenv("CONFIG", path)
+
+		cfg, err := config.Load(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:9091", cfg.Address)
+		assert.Equal(t, 30*time.Second, cfg.ExpirySweepInterval)
+		assert.Equal(t, 2*time.Second, cfg.DBQueryTimeout)
+		assert.Equal(t, path, cfg.ConfigFile)
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		path := writeConfigFile(t, "config.json", `{
+			"server_address": "localhost:1111",
+			"base_url": "http://file.example",
+			"log_level": "debug"
+		}`)
+		t.Setenv("SERVER_ADDRESS", "localhost:2222")
+		t.Setenv("BASE_URL", "http://env.example")
+
+		cfg, err := config.Load([]string{"-config", path, "-a", "localhost:3333"})
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:3333", cfg.Address)
+		assert.Equal(t, "http://env.example", cfg.ReturningAddress)
+		assert.Equal(t, "debug", cfg.LogLevel)
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "rate_limit_create: 30\nrate_limit_create_burst: 5\nrate_limit_idle_ttl: 1m\n")
+		t.Setenv("RATE_LIMIT_REDIRECT", "600")
+
+		cfg, err := config.Load([]string{"-c", path, "-rate-limit-create-burst", "7"})
+		require.NoError(t, err)
+		assert.Equal(t, 30, cfg.RateLimitCreate)
+		assert.Equal(t, 7, cfg.RateLimitCreateBurst)
+		assert.Equal(t, 600, cfg.RateLimitRedirect)
+		assert.Equal(t, 0, cfg.RateLimitBatch)
+		assert.Equal(t, time.Minute, cfg.RateLimitIdleTTL)
+
+		path = writeConfigFile(t, "config.yaml", "rate_limit_batch: -1\nrate_limit_redirect: 10\nrate_limit_redirect_burst: 0\n")
+		_, err = config.Load([]string{"-c", path})
+		var validationErr *config.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		fields := make([]string, 0, len(validationErr.Fields))
+		for _, f := range validationErr.Fields {
+			fields = append(fields, f.Field)
+		}
+		assert.ElementsMatch(t, []string{"rate_limit_batch", "rate_limit_redirect_burst"}, fields)
+	})
+
+	t.Run("url policy", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "url_denied_domains: [evil.com, \"*.phish.example\"]\nurl_allow_private_hosts: true\nurl_max_length: 512\n")
+		t.Setenv("URL_ALLOWED_DOMAINS", "example.com, *.example.com")
+
+		cfg, err := config.Load([]string{"-c", path, "-url-allowed-schemes", "https"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https"}, cfg.URLAllowedSchemes)
+		assert.Equal(t, []string{"example.com", "*.example.com"}, cfg.URLAllowedDomains)
+		assert.Equal(t, []string{"evil.com", "*.phish.example"}, cfg.URLDeniedDomains)
+		assert.True(t, cfg.URLAllowPrivateHosts)
+		assert.Equal(t, 512, cfg.URLMaxLength)
+
+		path = writeConfigFile(t, "config.json", `{"url_allowed_schemes": [], "url_denied_domains": ["ev*l.com"], "url_max_length": 0}`)
+		_, err = config.Load([]string{"-c", path})
+		var validationErr *config.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		fields := make([]string, 0, len(validationErr.Fields))
+		for _, f := range validationErr.Fields {
+			fields = append(fields, f.Field)
+		}
+		assert.ElementsMatch(t, []string{"url_allowed_schemes", "url_denied_domains", "url_max_length"}, fields)
+	})
+
+	t.Run("secret key", func(t *testing.T) {
+		cfg, err := config.Load(nil)
+		require.NoError(t, err)
+		assert.Empty(t, cfg.SecretKey, "Публичного ключа по умолчанию быть не должно")
+
+		t.Setenv("SECRET_KEY", "shortener-secret-key")
+		_, err = config.Load(nil)
+		var validationErr *config.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Len(t, validationErr.Fields, 1)
+		assert.Equal(t, "secret_key", validationErr.Fields[0].Field)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := writeConfigFile(t, "config.json", `{"server_adress": "localhost:1111"}`)
+
+		_, err := config.Load([]string{"-c", path})
+		assert.Error(t, err)
+	})
+
+	t.Run("all invalid fields reported", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yml", "server_address: nope\nbase_url: ftp://x\nlog_level: loud\nshort_path_generator: magic\ntls_cert_file: cert.pem\n")
+
+		_, err := config.Load([]string{"-c", path})
+		var validationErr *config.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+
+		fields := make([]string, 0, len(validationErr.Fields))
+		for _, f := range validationErr.Fields {
+			fields = append(fields, f.Field)
+		}
+		assert.ElementsMatch(t, []string{"server_address", "base_url", "log_level", "short_path_generator", "tls_cert_file"}, fields)
+	})
+}
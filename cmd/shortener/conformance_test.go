@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createBatch сохраняет пачку и проверяет, что хранилище приняло ее без ошибки.
+func createBatch(t *testing.T, storage dbstorage.URLStorage, records []dbstorage.URLRecord) []dbstorage.BatchItemResult {
+	t.Helper()
+	results, err := storage.CreateBatch(context.Background(), records)
+	require.NoError(t, err)
+	require.Len(t, results, len(records))
+	return results
+}
+
+// TestURLStorageConformance проверяет контракт URLStorage на всех реализациях.
+// PostgreSQL подключается, только если задан TEST_DATABASE_DSN.
+func TestURLStorageConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) dbstorage.URLStorage{
+		"memory": func(t *testing.T) dbstorage.URLStorage {
+			return dbstorage.NewMemoryStorage()
+		},
+		"file": func(t *testing.T) dbstorage.URLStorage {
+			storage, err := dbstorage.NewStorage(filepath.Join(t.TempDir(), "data.json"), dbstorage.DefaultFileOptions())
+			require.NoError(t, err)
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+		"file write-behind": func(t *testing.T) dbstorage.URLStorage {
+			opts := dbstorage.DefaultFileOptions()
+			opts.Durability = dbstorage.FileDurabilityAsync
+			storage, err := dbstorage.NewStorage(filepath.Join(t.TempDir(), "data.json"), opts)
+			require.NoError(t, err)
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+		"embedded": func(t *testing.T) dbstorage.URLStorage {
+			storage, err := dbstorage.NewBoltStorage(filepath.Join(t.TempDir(), "data.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+		"redis": func(t *testing.T) dbstorage.URLStorage {
+			_, addr := startFakeRedis(t)
+			storage, err := dbstorage.NewRedisStorage(addr, time.Second)
+			require.NoError(t, err)
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+		"cached": func(t *testing.T) dbstorage.URLStorage {
+			return dbstorage.NewCachedStorage(dbstorage.NewMemoryStorage(), dbstorage.CacheOptions{Size: 10, NegativeTTL: time.Minute})
+		},
+		"fake": func(t *testing.T) dbstorage.URLStorage {
+			return newFakeStorage(nil)
+		},
+	}
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		backends["postgres"] = func(t *testing.T) dbstorage.URLStorage {
+			result, err := dbstorage.InitializeStorage(dbstorage.Options{Kind: dbstorage.KindPostgres, DatabaseDSN: dsn, FailOnMigrationError: true})
+			require.NoError(t, err)
+			t.Cleanup(func() { result.Close() })
+			_, err = result.DB.Exec(context.Background(), "TRUNCATE urls CASCADE")
+			require.NoError(t, err)
+			return result.Storage
+		}
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			testURLStorageContract(t, open)
+		})
+	}
+}
+
+func testURLStorageContract(t *testing.T, open func(t *testing.T) dbstorage.URLStorage) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"}))
+
+		url, err := storage.Get(ctx, "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, "https://vk.com", url)
+
+		_, err = storage.Get(ctx, "missing")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+	})
+
+	t.Run("duplicate url returns existing short path", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+
+		err := storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://vk.com"})
+		var existsErr *dbstorage.ErrURLAlreadyExists
+		require.ErrorAs(t, err, &existsErr)
+		assert.Equal(t, "aaa", existsErr.ShortPath)
+
+		_, err = storage.Get(ctx, "bbb")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+	})
+
+	t.Run("url can be shortened again after delete", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"}))
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{{UserID: "user1", ShortPath: "aaa"}}))
+
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://vk.com"}))
+		url, err := storage.Get(ctx, "bbb")
+		require.NoError(t, err)
+		assert.Equal(t, "https://vk.com", url)
+		_, err = storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted)
+
+		// Новая ссылка снова занимает URL
+		err = storage.Create(ctx, dbstorage.URLRecord{ShortPath: "ccc", OriginalURL: "https://vk.com"})
+		var existsErr *dbstorage.ErrURLAlreadyExists
+		require.ErrorAs(t, err, &existsErr)
+		assert.Equal(t, "bbb", existsErr.ShortPath)
+
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{{UserID: "user1", ShortPath: "aaa"}}))
+		results := createBatch(t, storage, []dbstorage.URLRecord{{ShortPath: "ddd", OriginalURL: "https://vk.com"}})
+		assert.Equal(t, []dbstorage.BatchItemResult{{ShortPath: "bbb", Existed: true}}, results,
+			"Повторное удаление старой ссылки не должно освобождать URL новой")
+	})
+
+	t.Run("url can be shortened again after expiry", func(t *testing.T) {
+		storage := open(t)
+		past := time.Now().Add(-time.Minute)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", ExpiresAt: &past}))
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://ya.ru", ExpiresAt: &past}))
+
+		// Истекшая ссылка не занимает URL и до очистки
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "ccc", OriginalURL: "https://vk.com"}))
+
+		_, err := storage.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		results := createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "ddd", OriginalURL: "https://ya.ru"},
+			{ShortPath: "eee", OriginalURL: "https://vk.com"},
+		})
+		assert.Equal(t, []dbstorage.BatchItemResult{
+			{ShortPath: "ddd"},
+			{ShortPath: "ccc", Existed: true},
+		}, results)
+	})
+
+	t.Run("short path collision", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+
+		err := storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://ya.ru"})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+		assert.Equal(t, "aaa", collisionErr.ShortPath)
+
+		url, err := storage.Get(ctx, "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, "https://vk.com", url)
+	})
+
+	t.Run("batch reports existing urls per item", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+
+		results := createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "bbb", OriginalURL: "https://vk.com"},
+			{ShortPath: "ccc", OriginalURL: "https://ya.ru"},
+			{ShortPath: "ccc", OriginalURL: "https://ya.ru"},
+		})
+		assert.Equal(t, []dbstorage.BatchItemResult{
+			{ShortPath: "aaa", Existed: true},
+			{ShortPath: "ccc"},
+			{ShortPath: "ccc", Existed: true},
+		}, results)
+
+		_, err := storage.Get(ctx, "bbb")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+		count, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("batch collision is atomic", func(t *testing.T) {
+		storage := open(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+
+		_, err := storage.CreateBatch(ctx, []dbstorage.URLRecord{
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru"},
+			{ShortPath: "aaa", OriginalURL: "https://go.dev"},
+		})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+		assert.Equal(t, "aaa", collisionErr.ShortPath)
+
+		_, err = storage.Get(ctx, "bbb")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+
+		// После отката URL из пачки можно сохранить заново.
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "ccc", OriginalURL: "https://ya.ru"}))
+	})
+
+	t.Run("batch collision inside batch", func(t *testing.T) {
+		storage := open(t)
+
+		_, err := storage.CreateBatch(ctx, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com"},
+			{ShortPath: "aaa", OriginalURL: "https://ya.ru"},
+		})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+		assert.Equal(t, "aaa", collisionErr.ShortPath)
+
+		_, err = storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+	})
+
+	t.Run("delete only own urls", func(t *testing.T) {
+		storage := open(t)
+		createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user2"},
+		})
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{
+			{UserID: "user1", ShortPath: "aaa"},
+			{UserID: "user1", ShortPath: "bbb"},
+			{UserID: "user1", ShortPath: "missing"},
+		}))
+
+		_, err := storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted)
+		_, err = storage.Get(ctx, "bbb")
+		assert.NoError(t, err)
+
+		records, err := storage.GetUserURLs(ctx, "user1")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+		count, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("expired urls", func(t *testing.T) {
+		storage := open(t)
+		past := time.Now().Add(-time.Minute)
+		future := time.Now().Add(time.Hour)
+		createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", ExpiresAt: &past},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", ExpiresAt: &future},
+		})
+
+		_, err := storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrExpired)
+
+		n, err := storage.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		count, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("user urls and counters", func(t *testing.T) {
+		storage := open(t)
+		createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user1"},
+			{ShortPath: "ccc", OriginalURL: "https://go.dev", UserID: "user2"},
+			{ShortPath: "ddd", OriginalURL: "https://example.com"},
+		})
+
+		records, err := storage.GetUserURLs(ctx, "user1")
+		require.NoError(t, err)
+		shorts := make([]string, 0, len(records))
+		for _, record := range records {
+			assert.Equal(t, "user1", record.UserID)
+			shorts = append(shorts, record.ShortPath)
+		}
+		assert.ElementsMatch(t, []string{"aaa", "bbb"}, shorts)
+
+		urls, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, urls)
+		users, err := storage.CountUsers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, users)
+
+		// Пользователь, у которого остались только удаленные ссылки, не учитывается
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{{UserID: "user2", ShortPath: "ccc"}}))
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{{UserID: "user1", ShortPath: "aaa"}}))
+		users, err = storage.CountUsers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, users)
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/MaxRadzey/shortener/internal/models"
+	"github.com/MaxRadzey/shortener/internal/service"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortPathGenerators(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		pattern string
+	}{
+		{name: "hash", kind: service.GeneratorHash, pattern: `^[A-Za-z0-9_-]{6}$`},
+		{name: "random", kind: service.GeneratorRandom, pattern: `^[A-Za-z0-9]{8}$`},
+		{name: "sequential", kind: service.GeneratorSequential, pattern: `^[A-Za-z0-9]+$`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator, err := service.NewShortPathGenerator(test.kind)
+			require.NoError(t, err)
+
+			first, err := generator.Generate("https://vk.com", 0)
+			require.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(test.pattern), first)
+
+			// Повторная попытка для того же URL должна давать другой путь
+			second, err := generator.Generate("https://vk.com", 1)
+			require.NoError(t, err)
+			assert.NotEqual(t, first, second)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := service.NewShortPathGenerator("md5")
+		assert.Error(t, err)
+	})
+}
+
+func TestCreateShortURLCollision(t *testing.T) {
+	storage := dbstorage.NewMemoryStorage()
+	// Занимаем путь, который хэш-генератор выдаст для https://vk.com
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "XxLlqM", OriginalURL: "https://other.com"}))
+
+	urlService := service.NewService(storage, nil, *AppConfig, nil)
+
+	shortURL, err := urlService.CreateShortURL(context.Background(), "https://vk.com", "", service.CreateOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, AppConfig.ReturningAddress+"/XxLlqM", shortURL, "Коллизия не должна перезаписывать существующую ссылку")
+
+	original, err := urlService.GetLongURL(context.Background(), "XxLlqM")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.com", original)
+
+	items, err := urlService.CreateShortURLBatch(context.Background(), []models.BatchRequestItem{
+		{CorrelationID: "1", OriginalURL: "https://vk.com/batch"},
+		{CorrelationID: "2", OriginalURL: "https://vk.com"},
+	}, "")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, shortURL, items[1].ShortURL, "Повторная попытка должна давать тот же путь")
+}
+
+// collidingStorage на каждую пачку отвечает коллизией пути, которого в пачке нет.
+type collidingStorage struct {
+	*dbstorage.MemoryStorage
+	batches int
+}
+
+func (s *collidingStorage) CreateBatch(ctx context.Context, records []dbstorage.URLRecord) ([]dbstorage.BatchItemResult, error) {
+	s.batches++
+	return nil, &dbstorage.ErrShortPathCollision{ShortPath: "elsewhere"}
+}
+
+func TestCreateShortURLBatchCollisionLimit(t *testing.T) {
+	storage := &collidingStorage{MemoryStorage: dbstorage.NewMemoryStorage()}
+	urlService := service.NewService(storage, nil, *AppConfig, nil)
+
+	_, err := urlService.CreateShortURLBatch(context.Background(), []models.BatchRequestItem{
+		{CorrelationID: "1", OriginalURL: "https://vk.com"},
+	}, "")
+	assert.ErrorIs(t, err, service.ErrShortPathExhausted)
+	assert.Equal(t, 5, storage.batches, "Число попыток ограничено так же, как в CreateShortURL")
+}
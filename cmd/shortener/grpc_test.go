@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/grpcserver"
+	pb "github.com/MaxRadzey/shortener/internal/proto"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/MaxRadzey/shortener/internal/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupTestGRPCClient(t *testing.T) pb.ShortenerClient {
+	return setupTestGRPCClientWithLimits(t, ratelimit.NewLimits(*AppConfig))
+}
+
+func setupTestGRPCClientWithLimits(t *testing.T, limits *ratelimit.Limits) pb.ShortenerClient {
+	t.Helper()
+
+	handler := setupTestHandler(newFakeStorage(map[string]string{"abc123": "https://practicum.yandex.ru"}))
+	server := grpcserver.New(handler.Service, auth.NewSigner(AppConfig.SecretKey), limits)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func TestGRPCShortener(t *testing.T) {
+	client := setupTestGRPCClient(t)
+	ctx := context.Background()
+
+	t.Run("shorten and conflict", func(t *testing.T) {
+		var header metadata.MD
+		resp, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://vk.com"}, grpc.Header(&header))
+		require.NoError(t, err)
+		assert.Equal(t, AppConfig.ReturningAddress+"/XxLlqM", resp.GetShortUrl())
+		assert.NotEmpty(t, header.Get(auth.CookieName))
+
+		_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://go.dev", Alias: "XxLlqM"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "not a url"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = client.ShortenBatch(ctx, &pb.ShortenBatchRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		resp, err := client.Expand(ctx, &pb.ExpandRequest{ShortPath: "abc123"})
+		require.NoError(t, err)
+		assert.Equal(t, "https://practicum.yandex.ru", resp.GetOriginalUrl())
+
+		_, err = client.Expand(ctx, &pb.ExpandRequest{ShortPath: "missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("user urls", func(t *testing.T) {
+		_, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		var header metadata.MD
+		batch, err := client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: []*pb.BatchRequestItem{
+			{CorrelationId: "1", OriginalUrl: "https://ya.ru"},
+			{CorrelationId: "2", OriginalUrl: "https://go.dev"},
+		}}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Len(t, batch.GetItems(), 2)
+		assert.Equal(t, "1", batch.GetItems()[0].GetCorrelationId())
+
+		userCtx := metadata.AppendToOutgoingContext(ctx, auth.CookieName, header.Get(auth.CookieName)[0])
+		list, err := client.ListUserURLs(userCtx, &pb.ListUserURLsRequest{})
+		require.NoError(t, err)
+		assert.Len(t, list.GetUrls(), 2)
+
+		_, err = client.DeleteUserURLs(userCtx, &pb.DeleteUserURLsRequest{ShortPaths: []string{"abc123"}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("ping without database", func(t *testing.T) {
+		_, err := client.Ping(ctx, &pb.PingRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	ctx := context.Background()
+	cfg := *AppConfig
+	cfg.RateLimitCreate, cfg.RateLimitCreateBurst = 1, 2
+	cfg.RateLimitRedirect, cfg.RateLimitRedirectBurst = 1, 1
+
+	t.Run("limits per client", func(t *testing.T) {
+		client := setupTestGRPCClientWithLimits(t, ratelimit.NewLimits(cfg))
+
+		var codesGot []codes.Code
+		for i := 0; i < 3; i++ {
+			// Новый токен на каждый вызов не дает нового лимита
+			userCtx := metadata.AppendToOutgoingContext(ctx, auth.CookieName, auth.NewSigner(cfg.SecretKey).Sign("rotating-"+strconv.Itoa(i)))
+			var header metadata.MD
+			_, err := client.Shorten(userCtx, &pb.ShortenRequest{Url: "https://rotate.example.com/" + strconv.Itoa(i)}, grpc.Header(&header))
+			codesGot = append(codesGot, status.Code(err))
+			if status.Code(err) == codes.ResourceExhausted {
+				assert.Equal(t, []string{"60"}, header.Get("retry-after"))
+			}
+		}
+		assert.Equal(t, []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted}, codesGot)
+
+		_, err := client.Expand(ctx, &pb.ExpandRequest{ShortPath: "abc123"})
+		require.NoError(t, err)
+		_, err = client.Expand(ctx, &pb.ExpandRequest{ShortPath: "abc123"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+		_, err = client.Ping(ctx, &pb.PingRequest{})
+		assert.NotEqual(t, codes.ResourceExhausted, status.Code(err), "Вызовы без лимита не ограничиваются")
+	})
+
+	t.Run("limits shared with http", func(t *testing.T) {
+		limits := ratelimit.NewLimits(cfg)
+		client := setupTestGRPCClientWithLimits(t, limits)
+		r := router.SetupRouter(setupTestHandler(newFakeStorage(map[string]string{})), &cfg, limits)
+
+		token := auth.NewSigner(cfg.SecretKey).Sign("shared-user")
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://http.example.com/"+strconv.Itoa(i)))
+			req.RemoteAddr = "10.0.3." + strconv.Itoa(i) + ":1234"
+			req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, http.StatusCreated, w.Code)
+		}
+
+		userCtx := metadata.AppendToOutgoingContext(ctx, auth.CookieName, token)
+		_, err := client.Shorten(userCtx, &pb.ShortenRequest{Url: "https://grpc.example.com"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Лимит пользователя, израсходованный по HTTP, действует и в gRPC")
+	})
+}
@@ -2,13 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/MaxRadzey/shortener/internal/auth"
 	"github.com/MaxRadzey/shortener/internal/models"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/MaxRadzey/shortener/internal/router"
+	"github.com/MaxRadzey/shortener/internal/service"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -121,7 +130,7 @@ func TestCreateURL(t *testing.T) {
 			contentType: "text/plain; charset=utf-8",
 			want: want{
 				code:     http.StatusBadRequest,
-				response: "Invalid Body!",
+				response: "validation error: url must be absolute, with scheme and host",
 			},
 		},
 	}
@@ -196,7 +205,7 @@ func TestGetURLJSON(t *testing.T) {
 			contentType: "application/json",
 			want: want{
 				code:     http.StatusBadRequest,
-				response: "invalid request",
+				response: "validation error: url is empty",
 			},
 		},
 	}
@@ -253,7 +262,7 @@ func TestCreateURLBatch(t *testing.T) {
 			want: want{
 				code:        http.StatusCreated,
 				contentType: "application/json",
-				response:    `[{"correlation_id":"1","short_url":"http://localhost:8080/XxLlqM"},{"correlation_id":"2","short_url":"http://localhost:8080/` + getShortPathForURL("https://ya.ru") + `"}]`,
+				response:    `[{"correlation_id":"1","short_url":"http://localhost:8080/XxLlqM","status":"created"},{"correlation_id":"2","short_url":"http://localhost:8080/` + getShortPathForURL("https://ya.ru") + `","status":"created"}]`,
 			},
 		},
 		{
@@ -301,20 +310,49 @@ func TestCreateURLBatch(t *testing.T) {
 			want: want{
 				code:        http.StatusBadRequest,
 				contentType: "text/plain; charset=utf-8",
-				response:    "invalid request",
+				response:    `validation error: item "1": url must be absolute, with scheme and host`,
 			},
 		},
 		{
 			name:   "Test #6 single item batch",
 			method: http.MethodPost,
 			request: []models.BatchRequestItem{
-				{CorrelationID: "single", OriginalURL: "https://vk.com"},
+				{CorrelationID: "single", OriginalURL: "https://go.dev"},
+			},
+			contentType: "application/json",
+			want: want{
+				code:        http.StatusCreated,
+				contentType: "application/json",
+				response:    `[{"correlation_id":"single","short_url":"http://localhost:8080/` + getShortPathForURL("https://go.dev") + `","status":"created"}]`,
+			},
+		},
+		{
+			name:   "Test #7 batch with already shortened URL",
+			method: http.MethodPost,
+			request: []models.BatchRequestItem{
+				{CorrelationID: "1", OriginalURL: "https://vk.com"},
+				{CorrelationID: "2", OriginalURL: "https://example.com"},
+				{CorrelationID: "3", OriginalURL: "https://example.com"},
 			},
 			contentType: "application/json",
 			want: want{
 				code:        http.StatusCreated,
 				contentType: "application/json",
-				response:    `[{"correlation_id":"single","short_url":"http://localhost:8080/XxLlqM"}]`,
+				response:    `[{"correlation_id":"1","short_url":"http://localhost:8080/XxLlqM","status":"conflict"},{"correlation_id":"2","short_url":"http://localhost:8080/` + getShortPathForURL("https://example.com") + `","status":"created"},{"correlation_id":"3","short_url":"http://localhost:8080/` + getShortPathForURL("https://example.com") + `","status":"conflict"}]`,
+			},
+		},
+		{
+			name:   "Test #8 batch of already shortened URLs",
+			method: http.MethodPost,
+			request: []models.BatchRequestItem{
+				{CorrelationID: "1", OriginalURL: "https://vk.com"},
+				{CorrelationID: "2", OriginalURL: "https://ya.ru"},
+			},
+			contentType: "application/json",
+			want: want{
+				code:        http.StatusConflict,
+				contentType: "application/json",
+				response:    `[{"correlation_id":"1","short_url":"http://localhost:8080/XxLlqM","status":"conflict"},{"correlation_id":"2","short_url":"http://localhost:8080/` + getShortPathForURL("https://ya.ru") + `","status":"conflict"}]`,
 			},
 		},
 	}
@@ -347,7 +385,7 @@ func TestCreateURLBatch(t *testing.T) {
 
 			if test.want.response != "" {
 				actualResponse := strings.TrimSpace(w.Body.String())
-				if test.want.code == http.StatusCreated {
+				if test.want.contentType == "application/json" {
 					var actualItems []models.BatchResponseItem
 					err := json.Unmarshal([]byte(actualResponse), &actualItems)
 					require.NoError(t, err, "Ответ должен быть валидным JSON")
@@ -360,6 +398,7 @@ func TestCreateURLBatch(t *testing.T) {
 					for i, expected := range expectedItems {
 						assert.Equal(t, expected.CorrelationID, actualItems[i].CorrelationID, "CorrelationID не совпадает")
 						assert.Equal(t, expected.ShortURL, actualItems[i].ShortURL, "ShortURL не совпадает")
+						assert.Equal(t, expected.Status, actualItems[i].Status, "Status не совпадает")
 					}
 				} else {
 					assert.Equal(t, test.want.response, actualResponse, "Body не совпадает с ожидаемым")
@@ -368,3 +407,423 @@ func TestCreateURLBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestGetUserURLs(t *testing.T) {
+	storage := newFakeStorage(nil)
+	handler := setupTestHandler(storage)
+	router := setupTestRouter(handler)
+
+	t.Run("Test #1 request without cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	// Создаем ссылку и запоминаем выданную cookie пользователя
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://vk.com"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1, "Ожидается cookie с идентификатором пользователя")
+	userCookie := cookies[0]
+	defer w.Result().Body.Close()
+	assert.True(t, userCookie.HttpOnly)
+	assert.False(t, userCookie.Secure, "Без HTTPS cookie не помечается Secure")
+
+	t.Run("Test #2 user with urls", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(userCookie)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+		var items []models.UserURLItem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+		require.Len(t, items, 1)
+		assert.Equal(t, AppConfig.ReturningAddress+"/XxLlqM", items[0].ShortURL)
+		assert.Equal(t, "https://vk.com", items[0].OriginalURL)
+	})
+
+	t.Run("Test #3 user without urls", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: userCookie.Name, Value: auth.NewSigner(AppConfig.SecretKey).Sign("another-user")})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusNoContent, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Test #4 tampered cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: userCookie.Name, Value: userCookie.Value + "0"})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+}
+
+func TestAuthCookieSecure(t *testing.T) {
+	cfg := *AppConfig
+	cfg.EnableHTTPS = true
+	router := router.SetupRouter(setupTestHandler(newFakeStorage(nil)), &cfg, ratelimit.NewLimits(cfg))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://ya.ru"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	defer w.Result().Body.Close()
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].Secure, "При HTTPS cookie должна быть помечена Secure")
+	assert.True(t, cookies[0].HttpOnly)
+}
+
+func TestDeleteUserURLs(t *testing.T) {
+	storage := newFakeStorage(map[string]string{
+		"foreign": "https://ya.ru",
+	})
+	handler := setupTestHandler(storage)
+	router := setupTestRouter(handler)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://vk.com"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+	userCookie := w.Result().Cookies()[0]
+	defer w.Result().Body.Close()
+
+	t.Run("Test #1 request without cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["XxLlqM"]`))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Test #2 invalid body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`XxLlqM`))
+		r.AddCookie(userCookie)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusBadRequest, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Test #3 delete own and foreign urls", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["XxLlqM","foreign"]`))
+		r.AddCookie(userCookie)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusAccepted, w.Code, "Код ответа не совпадает с ожидаемым")
+
+		assert.Eventually(t, func() bool {
+			r := httptest.NewRequest(http.MethodGet, "/XxLlqM", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			return w.Code == http.StatusGone
+		}, 3*time.Second, 50*time.Millisecond, "Удаленная ссылка должна отдавать 410")
+
+		r = httptest.NewRequest(http.MethodGet, "/foreign", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code, "Чужая ссылка не должна удаляться")
+	})
+}
+
+func TestDeleteUserURLsDuringShutdown(t *testing.T) {
+	ctx := context.Background()
+	storage := dbstorage.NewMemoryStorage()
+	const total = 200
+	for i := 0; i < total; i++ {
+		record := dbstorage.URLRecord{ShortPath: fmt.Sprintf("s%d", i), OriginalURL: fmt.Sprintf("https://vk.com/%d", i), UserID: "user1"}
+		require.NoError(t, storage.Create(ctx, record))
+	}
+
+	urlService := service.NewService(storage, nil, *AppConfig, nil)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	urlService.Start(runCtx)
+
+	var (
+		mu       sync.Mutex
+		accepted []string
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < total; i++ {
+		if i == total/2 {
+			cancel()
+		}
+		wg.Add(1)
+		go func(shortPath string) {
+			defer wg.Done()
+			err := urlService.DeleteUserURLs(ctx, "user1", []string{shortPath})
+			if err != nil {
+				assert.ErrorIs(t, err, service.ErrShuttingDown)
+				return
+			}
+			mu.Lock()
+			accepted = append(accepted, shortPath)
+			mu.Unlock()
+		}(fmt.Sprintf("s%d", i))
+	}
+	wg.Wait()
+	urlService.Wait()
+
+	// Каждая задача, на которую клиент получил 202, должна дойти до хранилища
+	for _, shortPath := range accepted {
+		_, err := storage.Get(ctx, shortPath)
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted, "Удаление %s потеряно при остановке", shortPath)
+	}
+}
+
+func TestCreateURLAlias(t *testing.T) {
+	storage := newFakeStorage(nil)
+	handler := setupTestHandler(storage)
+	router := setupTestRouter(handler)
+
+	type want struct {
+		code     int
+		response string
+	}
+
+	tests := []struct {
+		name    string
+		request models.Request
+		want    want
+	}{
+		{
+			name:    "Test #1 create alias",
+			request: models.Request{URL: "https://vk.com", Alias: "spring-sale"},
+			want: want{
+				code:     http.StatusCreated,
+				response: `{"result":"http://localhost:8080/spring-sale"}`,
+			},
+		},
+		{
+			name:    "Test #2 same alias for same url",
+			request: models.Request{URL: "https://vk.com", Alias: "spring-sale"},
+			want: want{
+				code:     http.StatusConflict,
+				response: `{"result":"http://localhost:8080/spring-sale"}`,
+			},
+		},
+		{
+			name:    "Test #3 alias taken by another url",
+			request: models.Request{URL: "https://ya.ru", Alias: "spring-sale"},
+			want: want{
+				code:     http.StatusConflict,
+				response: "alias already taken",
+			},
+		},
+		{
+			name:    "Test #4 reserved alias",
+			request: models.Request{URL: "https://ya.ru", Alias: "PING"},
+			want: want{
+				code:     http.StatusBadRequest,
+				response: `validation error: alias "PING" is reserved`,
+			},
+		},
+		{
+			name:    "Test #5 invalid characters",
+			request: models.Request{URL: "https://ya.ru", Alias: "sale/2025"},
+			want: want{
+				code:     http.StatusBadRequest,
+				response: "validation error: alias may contain only latin letters, digits, '-' and '_'",
+			},
+		},
+		{
+			name:    "Test #6 too short alias",
+			request: models.Request{URL: "https://ya.ru", Alias: "ab"},
+			want: want{
+				code:     http.StatusBadRequest,
+				response: "validation error: alias length must be between 3 and 64 characters",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := json.Marshal(test.request)
+			r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(b))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, test.want.code, w.Code, "Код ответа не совпадает с ожидаемым")
+			require.Equal(t, test.want.response, strings.TrimSpace(w.Body.String()), "Body не совпадает с ожидаемым")
+		})
+	}
+
+	t.Run("Test #7 redirect by alias", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/spring-sale", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code, "Код ответа не совпадает с ожидаемым")
+		assert.Equal(t, "https://vk.com", w.Header().Get("Location"))
+	})
+}
+
+func TestURLExpiration(t *testing.T) {
+	storage := dbstorage.NewMemoryStorage()
+	expired := time.Now().Add(-time.Minute)
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "expired", OriginalURL: "https://vk.com", ExpiresAt: &expired}))
+
+	handler := setupTestHandler(storage)
+	router := setupTestRouter(handler)
+
+	t.Run("Test #1 expired link", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/expired", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusGone, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		request models.Request
+		code    int
+	}{
+		{
+			name:    "Test #2 ttl",
+			request: models.Request{URL: "https://ya.ru/ttl", TTLSeconds: 3600},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "Test #3 absolute expiry",
+			request: models.Request{URL: "https://ya.ru/absolute", ExpiresAt: &future},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "Test #4 expiry in the past",
+			request: models.Request{URL: "https://ya.ru/past", ExpiresAt: &past},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "Test #5 negative ttl",
+			request: models.Request{URL: "https://ya.ru/negative", TTLSeconds: -1},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "Test #6 both ttl and expiry",
+			request: models.Request{URL: "https://ya.ru/both", TTLSeconds: 60, ExpiresAt: &future},
+			code:    http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := json.Marshal(test.request)
+			r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(b))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, test.code, w.Code, "Код ответа не совпадает с ожидаемым")
+		})
+	}
+
+	t.Run("Test #7 sweeper marks expired links", func(t *testing.T) {
+		count, err := storage.DeleteExpired(context.Background(), time.Now().Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+
+		_, err = storage.Get(context.Background(), "expired")
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted)
+	})
+}
+
+func TestInternalStats(t *testing.T) {
+	storage := dbstorage.NewMemoryStorage()
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"}))
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user1"}))
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "ccc", OriginalURL: "https://go.dev", UserID: "user2"}))
+	require.NoError(t, storage.Create(context.Background(), dbstorage.URLRecord{ShortPath: "ddd", OriginalURL: "https://example.com"}))
+
+	handler := setupTestHandler(storage)
+
+	tests := []struct {
+		name   string
+		subnet string
+		realIP string
+		code   int
+	}{
+		{name: "Test #1 trusted ip", subnet: "192.168.1.0/24", realIP: "192.168.1.15", code: http.StatusOK},
+		{name: "Test #2 untrusted ip", subnet: "192.168.1.0/24", realIP: "10.0.0.1", code: http.StatusForbidden},
+		{name: "Test #3 missing header", subnet: "192.168.1.0/24", code: http.StatusForbidden},
+		{name: "Test #4 subnet not configured", realIP: "192.168.1.15", code: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := *AppConfig
+			cfg.TrustedSubnet = test.subnet
+			router := router.SetupRouter(handler, &cfg, ratelimit.NewLimits(cfg))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, test.code, w.Code, "Код ответа не совпадает с ожидаемым")
+			if test.code != http.StatusOK {
+				return
+			}
+
+			var stats models.InternalStats
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+			assert.Equal(t, models.InternalStats{URLs: 4, Users: 2}, stats)
+		})
+	}
+}
+
+func TestPingDetails(t *testing.T) {
+	handler := setupTestHandler(dbstorage.NewMemoryStorage())
+	router := setupTestRouter(handler)
+
+	t.Run("Test #1 plain ping without database", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Test #2 details", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ping?details=true", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+		var status models.PingStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.Equal(t, models.PingStatus{Status: "ok", Storage: "memory", Database: "disabled"}, status)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLogs подменяет глобальный логгер на время теста.
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core)
+	t.Cleanup(func() { logger.Log = prev })
+	return logs
+}
+
+func TestAccessLog(t *testing.T) {
+	router := setupTestRouter(setupTestHandler(newFakeStorage(map[string]string{"abc": "https://vk.com"})))
+
+	t.Run("single entry with request id from header", func(t *testing.T) {
+		logs := observeLogs(t)
+
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		r.Header.Set(middleware.RequestIDHeader, "req-42")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "req-42", w.Header().Get(middleware.RequestIDHeader))
+
+		entries := logs.FilterMessage("HTTP request").All()
+		require.Len(t, entries, 1, "На запрос должна приходиться одна запись access-лога")
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "GET", fields["method"])
+		assert.Equal(t, "/:short_path", fields["route"])
+		assert.Equal(t, "/abc", fields["path"])
+		assert.EqualValues(t, http.StatusTemporaryRedirect, fields["status"])
+		assert.Contains(t, fields, "size")
+		assert.Contains(t, fields, "latency")
+		assert.Equal(t, "192.0.2.1", fields["client_ip"])
+		assert.NotEmpty(t, fields["user_id"])
+		assert.Equal(t, "req-42", fields["request_id"])
+	})
+
+	t.Run("generated request id", func(t *testing.T) {
+		logs := observeLogs(t)
+
+		for _, header := range []string{"", "bad id\nforged", strings.Repeat("a", 200)} {
+			r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			if header != "" {
+				r.Header.Set(middleware.RequestIDHeader, header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			requestID := w.Header().Get(middleware.RequestIDHeader)
+			assert.Len(t, requestID, 32)
+			assert.NotEqual(t, header, requestID)
+		}
+		assert.Len(t, logs.FilterMessage("HTTP request").All(), 3)
+	})
+
+	t.Run("panic is logged with status 500", func(t *testing.T) {
+		logs := observeLogs(t)
+
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(middleware.AccessLog(), middleware.Recovery())
+		r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		panics := logs.FilterMessage("Panic while handling request").All()
+		require.Len(t, panics, 1)
+		requestID := w.Header().Get(middleware.RequestIDHeader)
+		assert.Equal(t, requestID, panics[0].ContextMap()["request_id"])
+
+		entries := logs.FilterMessage("HTTP request").All()
+		require.Len(t, entries, 1)
+		assert.Equal(t, zap.ErrorLevel, entries[0].Level)
+		assert.EqualValues(t, http.StatusInternalServerError, entries[0].ContextMap()["status"])
+	})
+}
@@ -1,20 +1,39 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/MaxRadzey/shortener/internal/app"
 	"github.com/MaxRadzey/shortener/internal/config"
-	"github.com/MaxRadzey/shortener/internal/logger"
-	"go.uber.org/zap"
 )
 
 func main() {
-	AppConfig := config.New()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	config.ParseEnv(AppConfig)
-	config.ParseFlags(AppConfig)
+	AppConfig, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		// Справка по флагам уже выведена пакетом flag
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
 	if err := app.Run(AppConfig); err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	logger.Log.Info("running server", zap.String("address", AppConfig.Address))
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	storage := dbstorage.NewInstrumentedStorage(dbstorage.NewMemoryStorage())
+	router := setupTestRouter(setupTestHandler(storage))
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/", "https://metrics.example.com")
+	require.Equal(t, http.StatusCreated, w.Code)
+	short := strings.TrimPrefix(w.Body.String(), "http://localhost:8080/")
+
+	assert.Equal(t, http.StatusTemporaryRedirect, do(http.MethodGet, "/"+short, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/missing-link", "").Code)
+	do(http.MethodGet, "/no/such/route", "")
+	do("BREW", "/", "")
+
+	w = do(http.MethodGet, "/metrics", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	metrics := string(body)
+
+	for _, series := range []string{
+		`shortener_http_requests_total{method="POST",route="/",status="201"}`,
+		`shortener_http_requests_total{method="GET",route="/:short_path",status="307"}`,
+		`shortener_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`shortener_http_request_duration_seconds_bucket{method="POST",route="/",le="+Inf"}`,
+		`shortener_redirects_total{result="hit"}`,
+		`shortener_redirects_total{result="miss"}`,
+		`shortener_storage_operation_duration_seconds_count{backend="memory",operation="create"}`,
+		`shortener_storage_operation_duration_seconds_count{backend="memory",operation="get"}`,
+		"go_goroutines",
+	} {
+		assert.Contains(t, metrics, series)
+	}
+	// Промах по ссылке не считается сбоем хранилища.
+	assert.NotContains(t, metrics, `shortener_storage_errors_total{backend="memory",operation="get"}`)
+	// Нестандартный метод не создает собственную серию.
+	assert.Contains(t, metrics, `shortener_http_requests_total{method="other",route="unmatched",status="405"}`)
+	assert.NotContains(t, metrics, `method="BREW"`)
+}
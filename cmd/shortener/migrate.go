@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/MaxRadzey/shortener/internal/logger"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+)
+
+const migrateUsage = "usage: shortener migrate [flags] up | down [N] | version | force VERSION"
+
+// migrateCommand разобранная команда подкоманды migrate.
+type migrateCommand struct {
+	name string
+	arg  int
+}
+
+// parseMigrateCommand разбирает позиционные аргументы подкоманды migrate.
+// Для down без аргумента откатывается одна миграция.
+func parseMigrateCommand(args []string) (migrateCommand, error) {
+	if len(args) == 0 {
+		return migrateCommand{}, errors.New(migrateUsage)
+	}
+
+	cmd := migrateCommand{name: args[0]}
+	switch cmd.name {
+	case "up", "version":
+		if len(args) != 1 {
+			return migrateCommand{}, errors.New(migrateUsage)
+		}
+	case "down":
+		cmd.arg = 1
+		if len(args) > 2 {
+			return migrateCommand{}, errors.New(migrateUsage)
+		}
+		if len(args) == 2 {
+			steps, err := strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return migrateCommand{}, fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			cmd.arg = steps
+		}
+	case "force":
+		if len(args) != 2 {
+			return migrateCommand{}, errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < -1 {
+			return migrateCommand{}, fmt.Errorf("invalid version %q", args[1])
+		}
+		cmd.arg = version
+	default:
+		return migrateCommand{}, fmt.Errorf("unknown migrate command %q\n%s", cmd.name, migrateUsage)
+	}
+
+	return cmd, nil
+}
+
+// runMigrate выполняет подкоманду migrate для базы из конфигурации (DATABASE_DSN или -d).
+func runMigrate(args []string) error {
+	AppConfig, rest, err := config.LoadWithArgs(args)
+	if err != nil {
+		return err
+	}
+	cmd, err := parseMigrateCommand(rest)
+	if err != nil {
+		return err
+	}
+	if AppConfig.DatabaseDSN == "" {
+		return errors.New("database DSN is required: set DATABASE_DSN or -d")
+	}
+	if err := logger.Initialize(AppConfig.LogLevel, AppConfig.LogFormat); err != nil {
+		return err
+	}
+
+	migrator, err := dbstorage.NewMigrator(AppConfig.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch cmd.name {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down(cmd.arg)
+	case "force":
+		err = migrator.Force(cmd.arg)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", cmd.name, err)
+	}
+
+	version, dirty, applied, err := migrator.Version()
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if !applied {
+		fmt.Println("no migrations applied")
+		return nil
+	}
+	if dirty {
+		fmt.Printf("version %d (dirty)\n", version)
+		return nil
+	}
+	fmt.Printf("version %d\n", version)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/MaxRadzey/shortener/migrations"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	source, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+	defer source.Close()
+
+	version, err := source.First()
+	require.NoError(t, err)
+
+	versions := []uint{version}
+	for {
+		next, err := source.Next(version)
+		if err != nil {
+			break
+		}
+		versions = append(versions, next)
+		version = next
+	}
+	assert.Equal(t, []uint{1, 2, 3, 4, 5, 6, 7}, versions, "Все миграции должны быть встроены в бинарный файл")
+
+	for _, v := range versions {
+		_, _, err := source.ReadDown(v)
+		assert.NoError(t, err, "Для каждой миграции нужен down файл")
+	}
+}
+
+func TestParseMigrateCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    migrateCommand
+		wantErr bool
+	}{
+		{name: "up", args: []string{"up"}, want: migrateCommand{name: "up"}},
+		{name: "down defaults to one step", args: []string{"down"}, want: migrateCommand{name: "down", arg: 1}},
+		{name: "down steps", args: []string{"down", "3"}, want: migrateCommand{name: "down", arg: 3}},
+		{name: "version", args: []string{"version"}, want: migrateCommand{name: "version"}},
+		{name: "force", args: []string{"force", "4"}, want: migrateCommand{name: "force", arg: 4}},
+		{name: "no command", args: nil, wantErr: true},
+		{name: "unknown command", args: []string{"sideways"}, wantErr: true},
+		{name: "force without version", args: []string{"force"}, wantErr: true},
+		{name: "invalid steps", args: []string{"down", "zero"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := parseMigrateCommand(test.args)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, cmd)
+		})
+	}
+}
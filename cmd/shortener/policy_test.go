@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/MaxRadzey/shortener/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPolicy(t *testing.T) {
+	cfg := *config.New()
+	cfg.ReturningAddress = "https://sho.rt"
+	cfg.URLDeniedDomains = []string{"evil.com", "*.phish.example"}
+	cfg.URLMaxLength = 64
+
+	tests := []struct {
+		name   string
+		url    string
+		reason string
+	}{
+		{name: "https", url: "https://vk.com/path?q=1"},
+		{name: "http with port", url: "http://Example.COM:8080/"},
+		{name: "public ip", url: "http://8.8.8.8/"},
+		{name: "empty", url: " ", reason: "url is empty"},
+		{name: "too long", url: "https://vk.com/" + strings.Repeat("a", 64), reason: "url is longer than 64 bytes"},
+		{name: "bare path", url: "/etc/passwd", reason: "url must be absolute, with scheme and host"},
+		{name: "no scheme", url: "vk.com", reason: "url must be absolute, with scheme and host"},
+		{name: "javascript", url: "javascript:alert(1)", reason: `scheme "javascript" is not allowed`},
+		{name: "file", url: "file:///etc/passwd", reason: `scheme "file" is not allowed`},
+		{name: "ftp", url: "ftp://files.example.com/a", reason: `scheme "ftp" is not allowed`},
+		{name: "no host", url: "https:///path", reason: "url must include a host"},
+		{name: "self", url: "http://SHO.RT./abc", reason: "url points to the shortener itself"},
+		{name: "localhost", url: "http://localhost:8080/", reason: `host "localhost" is a loopback address`},
+		{name: "loopback ip", url: "http://127.0.0.1/", reason: `host "127.0.0.1" is a loopback address`},
+		{name: "mapped loopback", url: "http://[::ffff:127.0.0.1]/", reason: `host "::ffff:127.0.0.1" is a loopback address`},
+		{name: "private ip", url: "http://10.1.2.3/admin", reason: `host "10.1.2.3" is a private address`},
+		{name: "this network", url: "http://0.1.2.3/", reason: `host "0.1.2.3" is a private address`},
+		{name: "cgnat", url: "http://100.100.100.200/latest/meta-data", reason: `host "100.100.100.200" is a private address`},
+		{name: "near cgnat", url: "http://100.128.0.1/"},
+		{name: "link local", url: "http://169.254.169.254/latest/meta-data", reason: `host "169.254.169.254" is a private address`},
+		{name: "decimal ip", url: "http://2130706433/", reason: `host "2130706433" is not a canonical IP address`},
+		{name: "denied domain", url: "https://evil.com/", reason: `domain "evil.com" is denied`},
+		{name: "denied subdomain", url: "https://login.phish.example/", reason: `domain "login.phish.example" is denied`},
+		{name: "wildcard excludes apex", url: "https://phish.example/"},
+	}
+
+	policy := service.NewURLPolicy(cfg)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Check(test.url)
+			if test.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *service.ErrValidation
+			require.True(t, errors.As(err, &validationErr), "Ожидается ошибка валидации, получено %v", err)
+			assert.Equal(t, test.reason, validationErr.Reason)
+		})
+	}
+
+	t.Run("allow list", func(t *testing.T) {
+		cfg := cfg
+		cfg.URLAllowedDomains = []string{"example.com", "*.example.com"}
+		policy := service.NewURLPolicy(cfg)
+
+		assert.NoError(t, policy.Check("https://example.com/"))
+		assert.NoError(t, policy.Check("https://docs.example.com/"))
+		err := policy.Check("https://example.org/")
+		var validationErr *service.ErrValidation
+		require.True(t, errors.As(err, &validationErr))
+		assert.Equal(t, `domain "example.org" is not in the allowed list`, validationErr.Reason)
+	})
+
+	t.Run("private hosts and custom schemes allowed", func(t *testing.T) {
+		cfg := cfg
+		cfg.URLAllowPrivateHosts = true
+		cfg.URLAllowedSchemes = []string{"HTTPS", "ftp"}
+		policy := service.NewURLPolicy(cfg)
+
+		assert.Error(t, policy.Check("http://vk.com/"), "Схема http не входит в список")
+		assert.NoError(t, policy.Check("ftp://192.168.0.1/file"))
+		assert.NoError(t, policy.Check("https://[::1]/"))
+		assert.NoError(t, policy.Check("https://localhost/"))
+		assert.Error(t, policy.Check("https://sho.rt/abc"), "Ссылка на сам сервис запрещена всегда")
+	})
+}
+
+func TestURLPolicyReasonInResponse(t *testing.T) {
+	router := setupTestRouter(setupTestHandler(newFakeStorage(map[string]string{})))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"file:///etc/passwd"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `validation error: scheme "file" is not allowed`, w.Body.String())
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/MaxRadzey/shortener/internal/router"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("burst then retry after", func(t *testing.T) {
+		limiter := ratelimit.New(60, 2, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			allowed, _ := limiter.Allow("client")
+			assert.True(t, allowed, "Запрос %d должен уложиться в burst", i+1)
+		}
+		allowed, retryAfter := limiter.Allow("client")
+		assert.False(t, allowed)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, time.Second)
+
+		allowed, _ = limiter.Allow("other")
+		assert.True(t, allowed, "Лимит одного ключа не должен влиять на другой")
+	})
+
+	t.Run("idle buckets are evicted", func(t *testing.T) {
+		limiter := ratelimit.New(60, 1, 20*time.Millisecond)
+		limiter.Allow("a")
+		limiter.Allow("b")
+		require.Equal(t, 2, limiter.Len())
+
+		time.Sleep(30 * time.Millisecond)
+		limiter.Allow("c")
+		assert.Equal(t, 1, limiter.Len(), "Простаивающие корзины должны удаляться")
+	})
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := *AppConfig
+	cfg.RateLimitCreate, cfg.RateLimitCreateBurst = 1, 2
+	cfg.RateLimitBatch, cfg.RateLimitBatchBurst = 1, 1
+	cfg.RateLimitRedirect, cfg.RateLimitRedirectBurst = 1, 1
+	r := router.SetupRouter(setupTestHandler(newFakeStorage(map[string]string{"abc": "https://vk.com"})), &cfg, ratelimit.NewLimits(cfg))
+
+	send := func(method, target, body, ip string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = ip + ":1234"
+		if strings.HasPrefix(target, "/api/") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("create endpoints share limit", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, send(http.MethodPost, "/", "https://a.example.com", "10.0.0.1", nil).Code)
+		require.Equal(t, http.StatusCreated, send(http.MethodPost, "/api/shorten", `{"url":"https://b.example.com"}`, "10.0.0.1", nil).Code)
+
+		w := send(http.MethodPost, "/", "https://c.example.com", "10.0.0.1", nil)
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.Equal(t, 60, retryAfter)
+
+		assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/", "https://c.example.com", "10.0.0.2", nil).Code,
+			"Другой IP должен иметь собственный лимит")
+	})
+
+	t.Run("batch and redirect have own limits", func(t *testing.T) {
+		batch := `[{"correlation_id":"1","original_url":"https://batch.example.com"}]`
+		assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/api/shorten/batch", batch, "10.0.0.1", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(http.MethodPost, "/api/shorten/batch", batch, "10.0.0.1", nil).Code)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, send(http.MethodGet, "/abc", "", "10.0.0.1", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(http.MethodGet, "/abc", "", "10.0.0.1", nil).Code)
+	})
+
+	t.Run("rotating cookies and forwarded headers do not bypass limit", func(t *testing.T) {
+		var codes []int
+		for i := 0; i < 3; i++ {
+			// Каждый запрос приходит с новой валидной cookie и новым X-Forwarded-For
+			cookie := &http.Cookie{Name: auth.CookieName, Value: auth.NewSigner(cfg.SecretKey).Sign("rotating-" + strconv.Itoa(i))}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://rotate.example.com/"+strconv.Itoa(i)))
+			req.RemoteAddr = "10.0.2.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+			req.AddCookie(cookie)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes = append(codes, w.Code)
+		}
+		assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests}, codes)
+	})
+
+	t.Run("forwarded header from trusted proxy", func(t *testing.T) {
+		cfg := cfg
+		cfg.TrustedProxies = []string{"192.0.2.0/24"}
+		r := router.SetupRouter(setupTestHandler(newFakeStorage(map[string]string{})), &cfg, ratelimit.NewLimits(cfg))
+
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://proxied.example.com/"+strconv.Itoa(i)))
+			req.RemoteAddr = "192.0.2.10:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusCreated, w.Code, "Клиенты за доверенным прокси считаются по X-Forwarded-For")
+		}
+	})
+
+	t.Run("authenticated user is limited by id", func(t *testing.T) {
+		cookie := &http.Cookie{Name: auth.CookieName, Value: auth.NewSigner(cfg.SecretKey).Sign("limited-user")}
+		for _, ip := range []string{"10.0.1.1", "10.0.1.2"} {
+			assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/", "https://"+ip+".example.com", ip, cookie).Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, send(http.MethodPost, "/", "https://u.example.com", "10.0.1.3", cookie).Code,
+			"Лимит пользователя не должен зависеть от IP")
+	})
+}
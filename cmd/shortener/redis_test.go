@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis минимальный сервер RESP2 в памяти с командами, которые использует RedisStorage.
+type fakeRedis struct {
+	mu      sync.Mutex
+	strings map[string]string
+	sets    map[string]map[string]struct{}
+	zsets   map[string]map[string]float64
+	// versions номера изменений строковых ключей для WATCH.
+	versions map[string]int
+	// commands считает выполненные команды по имени.
+	commands map[string]int
+	// before вызывается под mu перед выполнением команды с указанным именем.
+	before map[string]func()
+	// fail имена команд, следующий вызов которых завершится ошибкой без изменения данных.
+	fail map[string]bool
+}
+
+// fakeRedisConn состояние транзакции одного соединения.
+type fakeRedisConn struct {
+	watched map[string]int
+	multi   bool
+	queue   [][]string
+}
+
+// startFakeRedis запускает fakeRedis на свободном порту и возвращает его вместе с адресом.
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	srv := &fakeRedis{
+		strings:  make(map[string]string),
+		sets:     make(map[string]map[string]struct{}),
+		zsets:    make(map[string]map[string]float64),
+		versions: make(map[string]int),
+		commands: make(map[string]int),
+		before:   make(map[string]func()),
+		fail:     make(map[string]bool),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, listener.Addr().String()
+}
+
+// setBefore регистрирует действие, выполняемое перед следующей командой name.
+func (f *fakeRedis) setBefore(name string, fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.before[name] = fn
+}
+
+// failNext заставляет следующую команду name вернуть ошибку.
+func (f *fakeRedis) failNext(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail[name] = true
+}
+
+func (f *fakeRedis) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands[name]
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	session := &fakeRedisConn{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.exec(w, session, args)
+		// Ответы конвейера отправляются, когда прочитаны все пришедшие команды.
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimSuffix(line, "\r\n"), err
+}
+
+func (f *fakeRedis) exec(w *bufio.Writer, session *fakeRedisConn, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+	f.commands[name]++
+
+	switch name {
+	case "WATCH":
+		if session.watched == nil {
+			session.watched = make(map[string]int)
+		}
+		for _, key := range args[1:] {
+			session.watched[key] = f.versions[key]
+		}
+		fmt.Fprint(w, "+OK\r\n")
+	case "UNWATCH":
+		session.watched = nil
+		fmt.Fprint(w, "+OK\r\n")
+	case "MULTI":
+		session.multi = true
+		fmt.Fprint(w, "+OK\r\n")
+	case "DISCARD":
+		*session = fakeRedisConn{}
+		fmt.Fprint(w, "+OK\r\n")
+	case "EXEC":
+		queue, watched := session.queue, session.watched
+		*session = fakeRedisConn{}
+		for key, version := range watched {
+			if f.versions[key] != version {
+				fmt.Fprint(w, "*-1\r\n")
+				return
+			}
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(queue))
+		for _, queued := range queue {
+			f.run(w, queued)
+		}
+	default:
+		if session.multi {
+			session.queue = append(session.queue, args)
+			fmt.Fprint(w, "+QUEUED\r\n")
+			return
+		}
+		f.run(w, args)
+	}
+}
+
+// run выполняет команду над данными. Вызывается под f.mu.
+func (f *fakeRedis) run(w *bufio.Writer, args []string) {
+	name := strings.ToUpper(args[0])
+	if fn, ok := f.before[name]; ok {
+		delete(f.before, name)
+		fn()
+	}
+	if f.fail[name] {
+		delete(f.fail, name)
+		fmt.Fprint(w, "-ERR injected failure\r\n")
+		return
+	}
+
+	switch name {
+	case "HELLO":
+		fmt.Fprint(w, "-ERR unknown command 'HELLO'\r\n")
+	case "CLIENT", "SELECT":
+		fmt.Fprint(w, "+OK\r\n")
+	case "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case "GET":
+		value, ok := f.strings[args[1]]
+		writeBulk(w, value, ok)
+	case "SET":
+		_, exists := f.strings[args[1]]
+		for _, opt := range args[3:] {
+			switch strings.ToUpper(opt) {
+			case "NX":
+				if exists {
+					writeBulk(w, "", false)
+					return
+				}
+			case "XX":
+				if !exists {
+					writeBulk(w, "", false)
+					return
+				}
+			}
+		}
+		f.strings[args[1]] = args[2]
+		f.versions[args[1]]++
+		fmt.Fprint(w, "+OK\r\n")
+	case "MSET":
+		for i := 1; i+1 < len(args); i += 2 {
+			f.strings[args[i]] = args[i+1]
+			f.versions[args[i]]++
+		}
+		fmt.Fprint(w, "+OK\r\n")
+	case "MSETNX":
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := f.strings[args[i]]; ok {
+				fmt.Fprint(w, ":0\r\n")
+				return
+			}
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			f.strings[args[i]] = args[i+1]
+			f.versions[args[i]]++
+		}
+		fmt.Fprint(w, ":1\r\n")
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			value, ok := f.strings[key]
+			writeBulk(w, value, ok)
+		}
+	case "EXISTS":
+		found := 0
+		for _, key := range args[1:] {
+			if _, ok := f.strings[key]; ok {
+				found++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", found)
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.strings[key]; ok {
+				delete(f.strings, key)
+				f.versions[key]++
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case "SADD":
+		set, ok := f.sets[args[1]]
+		if !ok {
+			set = make(map[string]struct{})
+			f.sets[args[1]] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				added++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "SREM":
+		removed := 0
+		for _, member := range args[2:] {
+			if _, ok := f.sets[args[1]][member]; ok {
+				delete(f.sets[args[1]], member)
+				removed++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", removed)
+	case "SMEMBERS":
+		members := make([]string, 0, len(f.sets[args[1]]))
+		for member := range f.sets[args[1]] {
+			members = append(members, member)
+		}
+		writeArray(w, members)
+	case "SINTER":
+		var members []string
+		for member := range f.sets[args[1]] {
+			inAll := true
+			for _, key := range args[2:] {
+				if _, ok := f.sets[key][member]; !ok {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				members = append(members, member)
+			}
+		}
+		writeArray(w, members)
+	case "SCARD":
+		fmt.Fprintf(w, ":%d\r\n", len(f.sets[args[1]]))
+	case "ZADD":
+		zset, ok := f.zsets[args[1]]
+		if !ok {
+			zset = make(map[string]float64)
+			f.zsets[args[1]] = zset
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, ok := zset[args[i+1]]; !ok {
+				added++
+			}
+			zset[args[i+1]] = score
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "ZREM":
+		removed := 0
+		for _, member := range args[2:] {
+			if _, ok := f.zsets[args[1]][member]; ok {
+				delete(f.zsets[args[1]], member)
+				removed++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", removed)
+	case "ZRANGEBYSCORE":
+		lo, hi := parseScore(args[2]), parseScore(args[3])
+		var members []string
+		for member, score := range f.zsets[args[1]] {
+			if score >= lo && score <= hi {
+				members = append(members, member)
+			}
+		}
+		sort.Strings(members)
+		writeArray(w, members)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func parseScore(s string) float64 {
+	switch s {
+	case "-inf":
+		return math.Inf(-1)
+	case "+inf", "inf":
+		return math.Inf(1)
+	}
+	score, _ := strconv.ParseFloat(s, 64)
+	return score
+}
+
+func writeBulk(w *bufio.Writer, value string, ok bool) {
+	if !ok {
+		fmt.Fprint(w, "$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+}
+
+func writeArray(w *bufio.Writer, values []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(values))
+	for _, value := range values {
+		writeBulk(w, value, true)
+	}
+}
+
+func TestRedisStorage(t *testing.T) {
+	ctx := context.Background()
+
+	newStorage := func(t *testing.T) (*dbstorage.RedisStorage, *fakeRedis) {
+		srv, addr := startFakeRedis(t)
+		storage, err := dbstorage.NewRedisStorage(addr, time.Second)
+		require.NoError(t, err)
+		t.Cleanup(func() { storage.Close() })
+		return storage, srv
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		storage, _ := newStorage(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"}))
+
+		url, err := storage.Get(ctx, "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, "https://vk.com", url)
+
+		_, err = storage.Get(ctx, "bbb")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		storage, _ := newStorage(t)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+
+		err := storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://vk.com"})
+		var existsErr *dbstorage.ErrURLAlreadyExists
+		require.ErrorAs(t, err, &existsErr)
+		assert.Equal(t, "aaa", existsErr.ShortPath)
+
+		err = storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://ya.ru"})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+
+		// Обратный индекс освобождается после коллизии пути.
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "ccc", OriginalURL: "https://ya.ru"}))
+	})
+
+	t.Run("create writes record and index atomically", func(t *testing.T) {
+		storage, srv := newStorage(t)
+		record := dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}
+
+		// Сбой записи не должен оставить обратный индекс без записи ссылки
+		srv.failNext("MSETNX")
+		require.Error(t, storage.Create(ctx, record))
+		srv.mu.Lock()
+		_, indexed := srv.strings["shortener:origin:https://vk.com"]
+		srv.mu.Unlock()
+		assert.False(t, indexed)
+
+		require.NoError(t, storage.Create(ctx, record))
+		url, err := storage.Get(ctx, "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, "https://vk.com", url)
+	})
+
+	t.Run("orphaned origin index is reclaimed", func(t *testing.T) {
+		storage, srv := newStorage(t)
+		// Индекс, оставшийся после сбоя между двумя записями, указывает на несуществующую ссылку
+		srv.mu.Lock()
+		srv.strings["shortener:origin:https://vk.com"] = "ghost"
+		srv.mu.Unlock()
+
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com"}))
+		err := storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://vk.com"})
+		var existsErr *dbstorage.ErrURLAlreadyExists
+		require.ErrorAs(t, err, &existsErr)
+		assert.Equal(t, "aaa", existsErr.ShortPath)
+	})
+
+	t.Run("batch uses msetnx", func(t *testing.T) {
+		storage, srv := newStorage(t)
+		createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user1"},
+			{ShortPath: "ccc", OriginalURL: "https://go.dev", UserID: "user2"},
+		})
+		assert.Equal(t, 1, srv.count("MSETNX"))
+		assert.Zero(t, srv.count("MSET"))
+
+		records, err := storage.GetUserURLs(ctx, "user1")
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "aaa", records[0].ShortPath)
+		assert.Equal(t, "https://ya.ru", records[1].OriginalURL)
+
+		_, err = storage.CreateBatch(ctx, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com"},
+			{ShortPath: "bbb", OriginalURL: "https://example.com"},
+		})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+		assert.Equal(t, "bbb", collisionErr.ShortPath)
+
+		urls, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, urls)
+		users, err := storage.CountUsers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, users)
+	})
+
+	t.Run("batch does not overwrite concurrent create", func(t *testing.T) {
+		storage, srv := newStorage(t)
+		// Параллельный запрос успевает сократить тот же URL между проверкой и записью пачки
+		srv.setBefore("MSETNX", func() {
+			srv.strings["shortener:url:zzz"] = `{"original_url":"https://vk.com","user_id":"user9"}`
+			srv.strings["shortener:origin:https://vk.com"] = "zzz"
+		})
+
+		results := createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user1"},
+		})
+		assert.Equal(t, []dbstorage.BatchItemResult{
+			{ShortPath: "zzz", Existed: true},
+			{ShortPath: "bbb"},
+		}, results)
+		assert.Equal(t, 2, srv.count("MSETNX"))
+
+		_, err := storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrNotFound)
+		assert.JSONEq(t, `{"original_url":"https://vk.com","user_id":"user9"}`, srv.strings["shortener:url:zzz"],
+			"Чужая запись не должна перезаписываться")
+	})
+
+	t.Run("batch reports collision with concurrent short path", func(t *testing.T) {
+		storage, srv := newStorage(t)
+		srv.setBefore("MSETNX", func() {
+			srv.strings["shortener:url:aaa"] = `{"original_url":"https://example.com","user_id":"user9"}`
+		})
+
+		_, err := storage.CreateBatch(ctx, []dbstorage.URLRecord{{ShortPath: "aaa", OriginalURL: "https://vk.com"}})
+		var collisionErr *dbstorage.ErrShortPathCollision
+		require.ErrorAs(t, err, &collisionErr)
+		assert.Equal(t, "aaa", collisionErr.ShortPath)
+		assert.NotContains(t, srv.strings, "shortener:origin:https://vk.com")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		storage, _ := newStorage(t)
+		createBatch(t, storage, []dbstorage.URLRecord{
+			{ShortPath: "aaa", OriginalURL: "https://vk.com", UserID: "user1"},
+			{ShortPath: "bbb", OriginalURL: "https://ya.ru", UserID: "user2"},
+		})
+		require.NoError(t, storage.DeleteURLs(ctx, []dbstorage.DeleteItem{
+			{UserID: "user1", ShortPath: "aaa"},
+			{UserID: "user1", ShortPath: "bbb"},
+		}))
+
+		_, err := storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted)
+		_, err = storage.Get(ctx, "bbb")
+		assert.NoError(t, err)
+
+		urls, err := storage.CountURLs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, urls)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		storage, _ := newStorage(t)
+		expiresAt := time.Now().Add(time.Hour)
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "aaa", OriginalURL: "https://vk.com", ExpiresAt: &expiresAt}))
+		require.NoError(t, storage.Create(ctx, dbstorage.URLRecord{ShortPath: "bbb", OriginalURL: "https://ya.ru"}))
+
+		count, err := storage.DeleteExpired(ctx, expiresAt.Add(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		_, err = storage.Get(ctx, "aaa")
+		assert.ErrorIs(t, err, dbstorage.ErrDeleted)
+		count, err = storage.DeleteExpired(ctx, expiresAt.Add(time.Second))
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("selected by initialize storage", func(t *testing.T) {
+		_, addr := startFakeRedis(t)
+		result, err := dbstorage.InitializeStorage(dbstorage.Options{
+			Kind:      dbstorage.KindRedis,
+			RedisAddr: addr,
+		})
+		require.NoError(t, err)
+		defer result.Close()
+		assert.Equal(t, dbstorage.KindRedis, dbstorage.BackendName(result.Storage))
+	})
+}
@@ -2,58 +2,195 @@ package main
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/MaxRadzey/shortener/internal/config"
 	httphandlers "github.com/MaxRadzey/shortener/internal/handler"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
 	"github.com/MaxRadzey/shortener/internal/router"
 	"github.com/MaxRadzey/shortener/internal/service"
 	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
-var AppConfig = config.New()
+// AppConfig конфигурация тестов. Ключ подписи задается явно: по умолчанию он пустой
+// и генерируется только при запуске приложения.
+var AppConfig = func() *config.Config {
+	cfg := config.New()
+	cfg.SecretKey = "test-secret-key"
+	return cfg
+}()
 
 // FakeStorage - мок хранилища для тестов.
 type FakeStorage struct {
-	data map[string]string
+	mu   sync.Mutex
+	data map[string]dbstorage.URLRecord
 }
 
-func (f *FakeStorage) Get(short string) (string, error) {
+func (f *FakeStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := f.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
+
+func (f *FakeStorage) GetRecord(ctx context.Context, short string) (dbstorage.URLRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	val, ok := f.data[short]
 	if !ok {
-		return "", dbstorage.ErrNotFound
+		return dbstorage.URLRecord{}, dbstorage.ErrNotFound
+	}
+	if val.IsDeleted {
+		return dbstorage.URLRecord{}, dbstorage.ErrDeleted
+	}
+	if val.Expired(time.Now()) {
+		return dbstorage.URLRecord{}, dbstorage.ErrExpired
 	}
 	return val, nil
 }
 
-func (f *FakeStorage) Create(short, full string) error {
-	f.data[short] = full
+// findByOriginal ищет короткий путь активной ссылки на URL. Вызывать под mu.
+func (f *FakeStorage) findByOriginal(originalURL string) (string, bool) {
+	now := time.Now()
+	for short, record := range f.data {
+		if record.OriginalURL == originalURL && record.Active(now) {
+			return short, true
+		}
+	}
+	return "", false
+}
+
+func (f *FakeStorage) Create(ctx context.Context, record dbstorage.URLRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if short, ok := f.findByOriginal(record.OriginalURL); ok {
+		return &dbstorage.ErrURLAlreadyExists{ShortPath: short}
+	}
+	if _, ok := f.data[record.ShortPath]; ok {
+		return &dbstorage.ErrShortPathCollision{ShortPath: record.ShortPath}
+	}
+	f.data[record.ShortPath] = record
 	return nil
 }
 
-func (f *FakeStorage) CreateBatch(ctx context.Context, items []dbstorage.BatchItem) error {
+func (f *FakeStorage) CreateBatch(ctx context.Context, records []dbstorage.URLRecord) ([]dbstorage.BatchItemResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := make([]dbstorage.BatchItemResult, len(records))
+	created := make(map[string]dbstorage.URLRecord, len(records))
+	for i, record := range records {
+		if short, ok := f.findByOriginal(record.OriginalURL); ok {
+			results[i] = dbstorage.BatchItemResult{ShortPath: short, Existed: true}
+			continue
+		}
+		if existing, ok := created[record.ShortPath]; ok && existing.OriginalURL == record.OriginalURL {
+			results[i] = dbstorage.BatchItemResult{ShortPath: record.ShortPath, Existed: true}
+			continue
+		}
+		if _, ok := f.data[record.ShortPath]; ok {
+			return nil, &dbstorage.ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+		if _, ok := created[record.ShortPath]; ok {
+			return nil, &dbstorage.ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+		created[record.ShortPath] = record
+		results[i] = dbstorage.BatchItemResult{ShortPath: record.ShortPath}
+	}
+	for short, record := range created {
+		f.data[short] = record
+	}
+	return results, nil
+}
+
+func (f *FakeStorage) GetUserURLs(ctx context.Context, userID string) ([]dbstorage.URLRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var records []dbstorage.URLRecord
+	for _, record := range f.data {
+		if record.UserID == userID && !record.IsDeleted {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (f *FakeStorage) DeleteURLs(ctx context.Context, items []dbstorage.DeleteItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	for _, item := range items {
-		f.data[item.ShortPath] = item.FullURL
+		record, ok := f.data[item.ShortPath]
+		if ok && record.UserID == item.UserID {
+			record.IsDeleted = true
+			f.data[item.ShortPath] = record
+		}
 	}
 	return nil
 }
 
+func (f *FakeStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var count int64
+	for short, record := range f.data {
+		if !record.IsDeleted && record.Expired(now) {
+			record.IsDeleted = true
+			f.data[short] = record
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *FakeStorage) CountURLs(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, record := range f.data {
+		if !record.IsDeleted {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *FakeStorage) CountUsers(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	users := make(map[string]struct{})
+	for _, record := range f.data {
+		if record.UserID != "" && !record.IsDeleted {
+			users[record.UserID] = struct{}{}
+		}
+	}
+	return len(users), nil
+}
+
 // newFakeStorage создает новый экземпляр FakeStorage.
 func newFakeStorage(data map[string]string) *FakeStorage {
-	if data == nil {
-		data = make(map[string]string)
+	records := make(map[string]dbstorage.URLRecord, len(data))
+	for short, full := range data {
+		records[short] = dbstorage.URLRecord{ShortPath: short, OriginalURL: full}
 	}
-	return &FakeStorage{data: data}
+	return &FakeStorage{data: records}
 }
 
 // setupTestHandler создает handler для тестов с указанным хранилищем.
 func setupTestHandler(storage dbstorage.URLStorage) *httphandlers.Handler {
-	urlService := service.NewService(storage, *AppConfig, nil)
+	urlService := service.NewService(storage, nil, *AppConfig, nil)
+	urlService.Start(context.Background())
 	return &httphandlers.Handler{Service: urlService}
 }
 
 // setupTestRouter создает роутер для тестов с указанным handler.
 func setupTestRouter(handler *httphandlers.Handler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
-	return router.SetupRouter(handler)
+	return router.SetupRouter(handler, AppConfig, ratelimit.NewLimits(*AppConfig))
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/MaxRadzey/shortener/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// exportedSpan поля спана в выводе stdouttrace, которые проверяют тесты.
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		SpanID string
+	}
+}
+
+func TestTracing(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	path := filepath.Join(t.TempDir(), "spans.json")
+	stop, err := tracing.Setup(path)
+	require.NoError(t, err)
+
+	storage := dbstorage.NewInstrumentedStorage(dbstorage.NewMemoryStorage())
+	router := setupTestRouter(setupTestHandler(storage))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://tracing.example.com"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	require.NoError(t, stop(context.Background()))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	spans := make(map[string]exportedSpan)
+	decoder := json.NewDecoder(f)
+	for {
+		var span exportedSpan
+		err := decoder.Decode(&span)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		spans[span.Name] = span
+	}
+
+	for _, name := range []string{
+		"POST /api/shorten",
+		"handler.decodeRequest",
+		"service.CreateShortURL",
+		"service.generateShortPath",
+		"storage.create",
+	} {
+		span, ok := spans[name]
+		require.True(t, ok, "Спан %s не экспортирован", name)
+		assert.Equal(t, traceID, span.SpanContext.TraceID, "Спан %s должен продолжать входящую трассу", name)
+	}
+	assert.Equal(t, "00f067aa0ba902b7", spans["POST /api/shorten"].Parent.SpanID)
+	assert.Equal(t, spans["POST /api/shorten"].SpanContext.SpanID, spans["service.CreateShortURL"].Parent.SpanID)
+	assert.Equal(t, spans["service.CreateShortURL"].SpanContext.SpanID, spans["storage.create"].Parent.SpanID)
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core)
+	t.Cleanup(func() { logger.Log = prev })
+
+	logger.FromContext(context.Background()).Info("without trace")
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	logger.FromContext(ctx).Info("with trace")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Empty(t, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{
+		"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":  "00f067aa0ba902b7",
+	}, entries[1].ContextMap())
+}
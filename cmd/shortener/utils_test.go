@@ -42,32 +42,6 @@ func TestGetShortPath(t *testing.T) {
 	}
 }
 
-func TestIsValidURL(t *testing.T) {
-	tests := []struct {
-		name     string
-		inputURL string
-		want     bool
-	}{
-		{
-			name:     "Valid URL",
-			inputURL: "https://vk.ccom",
-			want:     true,
-		},
-		{
-			name:     "Invalid URL",
-			inputURL: "123",
-			want:     false,
-		},
-	}
-
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			result := utils.IsValidURL(test.inputURL)
-			assert.Equal(t, result, test.want)
-		})
-	}
-}
-
 // getShortPathForURL возвращает короткий путь для URL (для тестов).
 func getShortPathForURL(url string) string {
 	path, _ := utils.GetShortPath(url)
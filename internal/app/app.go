@@ -1,33 +1,348 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/certs"
 	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/MaxRadzey/shortener/internal/grpcserver"
 	httphandlers "github.com/MaxRadzey/shortener/internal/handler"
 	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/metrics"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
 	"github.com/MaxRadzey/shortener/internal/router"
 	"github.com/MaxRadzey/shortener/internal/service"
 	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/MaxRadzey/shortener/internal/tracing"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-// Run запускает http сервер.
-func Run(AppConfig *config.Config) error {
-	if err := logger.Initialize(AppConfig.LogLevel); err != nil {
-		return err
+// App связывает хранилище, сервис, HTTP и gRPC серверы и управляет их жизненным циклом.
+type App struct {
+	config     *config.Config
+	storage    *dbstorage.StorageResult
+	service    *service.Service
+	server     *http.Server
+	grpcServer *grpc.Server
+	// stopTracing сбрасывает накопленные спаны и закрывает вывод трассировки.
+	stopTracing func(context.Context) error
+
+	listener     net.Listener
+	grpcListener net.Listener
+	serving      sync.WaitGroup
+	serveErr     chan error
+	workersCtx   context.Context
+	stopWorkers  context.CancelFunc
+}
+
+// New инициализирует логгер, хранилище, сервис, HTTP и gRPC серверы, но не начинает обслуживать запросы.
+func New(AppConfig *config.Config) (*App, error) {
+	if err := logger.Initialize(AppConfig.LogLevel, AppConfig.LogFormat); err != nil {
+		return nil, err
+	}
+
+	if AppConfig.SecretKey == "" {
+		key, err := auth.NewSecretKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate secret key: %w", err)
+		}
+		AppConfig.SecretKey = key
+		logger.Log.Warn("SECRET_KEY is not set, using a random key: user cookies and visitor hashes will not survive a restart")
+	}
+
+	var tlsConfig *tls.Config
+	if AppConfig.EnableHTTPS {
+		var err error
+		tlsConfig, err = loadTLSConfig(AppConfig)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	storageResult, err := dbstorage.InitializeStorage(AppConfig.DatabaseDSN, AppConfig.FilePath)
+	storageResult, err := dbstorage.InitializeStorage(dbstorage.Options{
+		Kind:        AppConfig.Storage,
+		DatabaseDSN: AppConfig.DatabaseDSN,
+		RedisAddr:   AppConfig.RedisAddr,
+		FilePath:    AppConfig.FilePath,
+		File: dbstorage.FileOptions{
+			Sync:            dbstorage.FileSyncMode(AppConfig.FileSync),
+			SyncInterval:    AppConfig.FileSyncInterval,
+			CompactInterval: AppConfig.FileCompactInterval,
+			Durability:      dbstorage.FileDurability(AppConfig.FileDurability),
+			QueueSize:       AppConfig.FileQueueSize,
+			FlushSize:       AppConfig.FileFlushSize,
+			FlushInterval:   AppConfig.FileFlushInterval,
+		},
+		FailOnMigrationError: AppConfig.MigrationsFailFast,
+		QueryTimeout:         AppConfig.DBQueryTimeout,
+		Cache: dbstorage.CacheOptions{
+			Size:        AppConfig.CacheSize,
+			TTL:         AppConfig.CacheTTL,
+			NegativeTTL: AppConfig.CacheNegativeTTL,
+		},
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	metrics.SetPool(storageResult.DB)
 
-	urlService := service.NewService(storageResult.Storage, *AppConfig, storageResult.DB)
+	stopTracing, err := tracing.Setup(AppConfig.TraceOutput)
+	if err != nil {
+		_ = storageResult.Close()
+		return nil, err
+	}
+
+	urlService := service.NewService(storageResult.Storage, storageResult.Clicks, *AppConfig, storageResult.DB)
 	h := &httphandlers.Handler{
 		Service: urlService,
 	}
 
-	r := router.SetupRouter(h)
+	// Лимиты общие для HTTP и gRPC, чтобы смена протокола не давала клиенту новый лимит
+	limits := ratelimit.NewLimits(*AppConfig)
+
+	var grpcServer *grpc.Server
+	if AppConfig.GRPCAddress != "" {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer = grpcserver.New(urlService, auth.NewSigner(AppConfig.SecretKey), limits, opts...)
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+
+	return &App{
+		config:  AppConfig,
+		storage: storageResult,
+		service: urlService,
+		server: &http.Server{
+			Addr:      AppConfig.Address,
+			Handler:   router.SetupRouter(h, AppConfig, limits),
+			TLSConfig: tlsConfig,
+		},
+		grpcServer:  grpcServer,
+		stopTracing: stopTracing,
+		serveErr:    make(chan error, 2),
+		stopWorkers: stopWorkers,
+		workersCtx:  workersCtx,
+	}, nil
+}
+
+// Start запускает фоновые воркеры и начинает принимать HTTP и gRPC запросы.
+// Метод не блокируется: ошибка работы серверов доступна через Errors.
+func (a *App) Start() error {
+	listener, err := net.Listen("tcp", a.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", a.config.Address, err)
+	}
+	a.listener = listener
+
+	if a.grpcServer != nil {
+		grpcListener, err := net.Listen("tcp", a.config.GRPCAddress)
+		if err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", a.config.GRPCAddress, err)
+		}
+		a.grpcListener = grpcListener
+	}
+
+	a.service.Start(a.workersCtx)
+
+	logger.Log.Info("Starting HTTP server",
+		zap.String("address", listener.Addr().String()),
+		zap.Bool("https", a.config.EnableHTTPS))
+	a.serving.Add(1)
+	go func() {
+		defer a.serving.Done()
+		var err error
+		if a.server.TLSConfig != nil {
+			// Сертификаты уже загружены в TLSConfig, поэтому пути к файлам не передаем
+			err = a.server.ServeTLS(listener, "", "")
+		} else {
+			err = a.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.serveErr <- err
+		}
+	}()
+
+	if a.grpcServer != nil {
+		logger.Log.Info("Starting gRPC server", zap.String("address", a.grpcListener.Addr().String()))
+		a.serving.Add(1)
+		go func() {
+			defer a.serving.Done()
+			if err := a.grpcServer.Serve(a.grpcListener); err != nil {
+				a.serveErr <- fmt.Errorf("grpc server: %w", err)
+			}
+		}()
+	}
+
+	go func() {
+		a.serving.Wait()
+		close(a.serveErr)
+	}()
+
+	return nil
+}
+
+// Addr возвращает адрес, на котором сервер принимает соединения. До вызова Start возвращает nil.
+func (a *App) Addr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// GRPCAddr возвращает адрес gRPC сервера. Если gRPC отключен или Start не вызван, возвращает nil.
+func (a *App) GRPCAddr() net.Addr {
+	if a.grpcListener == nil {
+		return nil
+	}
+	return a.grpcListener.Addr()
+}
+
+// Errors возвращает канал, в который попадает ошибка сервера, если он остановился сам.
+// Канал закрывается после остановки всех серверов.
+func (a *App) Errors() <-chan error {
+	return a.serveErr
+}
+
+// Shutdown останавливает приложение в порядке, обратном запуску:
+// дожидается завершения текущих запросов, останавливает фоновые воркеры
+// (сбрасывая накопленные удаления и переходы), закрывает хранилище и сбрасывает буфер логгера.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	logger.Log.Info("Shutting down HTTP server")
+	if err := a.server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server shutdown: %w", err))
+	}
+
+	if a.grpcServer != nil {
+		logger.Log.Info("Shutting down gRPC server")
+		if err := a.stopGRPC(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("grpc server shutdown: %w", err))
+		}
+	}
+
+	logger.Log.Info("Stopping background workers")
+	a.stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		a.service.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("background workers shutdown: %w", ctx.Err()))
+	}
+
+	logger.Log.Info("Closing storage")
+	metrics.SetPool(nil)
+	if err := a.storage.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("storage close: %w", err))
+	}
+
+	if err := a.stopTracing(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("tracing shutdown: %w", err))
+	}
+
+	logger.Log.Info("Shutdown completed")
+	// Ошибку Sync игнорируем: для stderr на части платформ она возвращается всегда
+	_ = logger.Log.Sync()
+
+	return errors.Join(errs...)
+}
+
+// stopGRPC дожидается завершения текущих gRPC вызовов, а по истечении ctx
+// закрывает оставшиеся соединения принудительно.
+func (a *App) stopGRPC(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// loadTLSConfig загружает сертификат из файлов конфигурации или, если они не указаны,
+// генерирует самоподписанный сертификат для хоста из ReturningAddress.
+func loadTLSConfig(AppConfig *config.Config) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case AppConfig.TLSCertFile != "" && AppConfig.TLSKeyFile != "":
+		cert, err = tls.LoadX509KeyPair(AppConfig.TLSCertFile, AppConfig.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+	case AppConfig.TLSCertFile != "" || AppConfig.TLSKeyFile != "":
+		return nil, errors.New("both TLS certificate and key files must be provided")
+	default:
+		baseURL, err := url.Parse(AppConfig.ReturningAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse base URL: %w", err)
+		}
+		hosts := []string{baseURL.Hostname(), "localhost", "127.0.0.1", "::1"}
+		cert, err = certs.GenerateSelfSigned(hosts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+		}
+		logger.Log.Warn("Using self-signed TLS certificate", zap.Strings("hosts", hosts))
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Run запускает приложение и блокируется до получения SIGINT, SIGTERM или SIGQUIT,
+// после чего корректно останавливает его за время config.ShutdownTimeout.
+func Run(AppConfig *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	a, err := New(AppConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Start(); err != nil {
+		return errors.Join(err, a.Shutdown(context.Background()))
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		logger.Log.Info("Received shutdown signal")
+	case serveErr = <-a.Errors():
+		logger.Log.Error("Server stopped unexpectedly", zap.Error(serveErr))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), AppConfig.ShutdownTimeout)
+	defer cancel()
 
-	logger.Log.Info("Starting HTTP server", zap.String("address", AppConfig.Address))
-	return r.Run(AppConfig.Address)
+	return errors.Join(serveErr, a.Shutdown(shutdownCtx))
 }
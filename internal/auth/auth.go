@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// CookieName имя cookie, в которой хранится подписанный идентификатор пользователя.
+const CookieName = "user_id"
+
+// Signer подписывает идентификаторы пользователей с помощью HMAC-SHA256
+// и проверяет ранее выданные подписи.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner создает Signer с указанным секретным ключом.
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret)}
+}
+
+// NewUserID генерирует новый случайный идентификатор пользователя.
+func NewUserID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewSecretKey генерирует случайный ключ подписи.
+func NewSecretKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign возвращает токен вида <userID>.<подпись>.
+func (s *Signer) Sign(userID string) string {
+	return userID + "." + hex.EncodeToString(s.mac(userID))
+}
+
+// Verify проверяет подпись токена и возвращает идентификатор пользователя.
+// Второе значение равно false, если токен поврежден или подписан другим ключом.
+func (s *Signer) Verify(token string) (string, bool) {
+	userID, signature, found := strings.Cut(token, ".")
+	if !found || userID == "" {
+		return "", false
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return "", false
+	}
+
+	if !hmac.Equal(got, s.mac(userID)) {
+		return "", false
+	}
+	return userID, true
+}
+
+func (s *Signer) mac(userID string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(userID))
+	return h.Sum(nil)
+}
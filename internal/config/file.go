@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig структура файла конфигурации. Поля-указатели позволяют отличить
+// отсутствующий ключ от явно заданного нулевого значения.
+type fileConfig struct {
+	ServerAddress       *string `json:"server_address" yaml:"server_address"`
+	BaseURL             *string `json:"base_url" yaml:"base_url"`
+	LogLevel            *string `json:"log_level" yaml:"log_level"`
+	LogFormat           *string `json:"log_format" yaml:"log_format"`
+	FileStoragePath     *string `json:"file_storage_path" yaml:"file_storage_path"`
+	DatabaseDSN         *string `json:"database_dsn" yaml:"database_dsn"`
+	RedisAddr           *string `json:"redis_addr" yaml:"redis_addr"`
+	SecretKey           *string `json:"secret_key" yaml:"secret_key"`
+	ShortPathGenerator  *string `json:"short_path_generator" yaml:"short_path_generator"`
+	ExpirySweepInterval *string `json:"expiry_sweep_interval" yaml:"expiry_sweep_interval"`
+	ShutdownTimeout     *string `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	DBQueryTimeout      *string `json:"db_query_timeout" yaml:"db_query_timeout"`
+	CacheSize           *int    `json:"cache_size" yaml:"cache_size"`
+	CacheTTL            *string `json:"cache_ttl" yaml:"cache_ttl"`
+	CacheNegativeTTL    *string `json:"cache_negative_ttl" yaml:"cache_negative_ttl"`
+	EnableHTTPS         *bool   `json:"enable_https" yaml:"enable_https"`
+	TLSCertFile         *string `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile          *string `json:"tls_key_file" yaml:"tls_key_file"`
+	FileSync            *string `json:"file_sync" yaml:"file_sync"`
+	FileSyncInterval    *string `json:"file_sync_interval" yaml:"file_sync_interval"`
+	FileCompactInterval *string `json:"file_compact_interval" yaml:"file_compact_interval"`
+	FileDurability      *string `json:"file_durability" yaml:"file_durability"`
+	FileQueueSize       *int    `json:"file_queue_size" yaml:"file_queue_size"`
+	FileFlushSize       *int    `json:"file_flush_size" yaml:"file_flush_size"`
+	FileFlushInterval   *string `json:"file_flush_interval" yaml:"file_flush_interval"`
+	Storage             *string `json:"storage" yaml:"storage"`
+	MigrationsFailFast  *bool   `json:"migrations_fail_fast" yaml:"migrations_fail_fast"`
+	GRPCAddress         *string `json:"grpc_address" yaml:"grpc_address"`
+	TrustedSubnet       *string `json:"trusted_subnet" yaml:"trusted_subnet"`
+	TraceOutput         *string `json:"trace_output" yaml:"trace_output"`
+
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
+	// Лимиты запросов
+	RateLimitCreate        *int    `json:"rate_limit_create" yaml:"rate_limit_create"`
+	RateLimitCreateBurst   *int    `json:"rate_limit_create_burst" yaml:"rate_limit_create_burst"`
+	RateLimitBatch         *int    `json:"rate_limit_batch" yaml:"rate_limit_batch"`
+	RateLimitBatchBurst    *int    `json:"rate_limit_batch_burst" yaml:"rate_limit_batch_burst"`
+	RateLimitRedirect      *int    `json:"rate_limit_redirect" yaml:"rate_limit_redirect"`
+	RateLimitRedirectBurst *int    `json:"rate_limit_redirect_burst" yaml:"rate_limit_redirect_burst"`
+	RateLimitIdleTTL       *string `json:"rate_limit_idle_ttl" yaml:"rate_limit_idle_ttl"`
+
+	// Политика ссылок назначения
+	URLAllowedSchemes    []string `json:"url_allowed_schemes" yaml:"url_allowed_schemes"`
+	URLAllowedDomains    []string `json:"url_allowed_domains" yaml:"url_allowed_domains"`
+	URLDeniedDomains     []string `json:"url_denied_domains" yaml:"url_denied_domains"`
+	URLAllowPrivateHosts *bool    `json:"url_allow_private_hosts" yaml:"url_allow_private_hosts"`
+	URLMaxLength         *int     `json:"url_max_length" yaml:"url_max_length"`
+}
+
+// ParseFile обновляет конфигурацию значениями из файла.
+// Формат определяется по расширению: .yaml и .yml — YAML, остальные — JSON.
+// Неизвестные ключи считаются ошибкой, чтобы опечатки не проходили незамеченными.
+func ParseFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var fc fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fc)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fc)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	return fc.apply(config)
+}
+
+func (fc *fileConfig) apply(config *Config) error {
+	setString(&config.Address, fc.ServerAddress)
+	setString(&config.ReturningAddress, fc.BaseURL)
+	setString(&config.LogLevel, fc.LogLevel)
+	setString(&config.LogFormat, fc.LogFormat)
+	setString(&config.FilePath, fc.FileStoragePath)
+	setString(&config.DatabaseDSN, fc.DatabaseDSN)
+	setString(&config.RedisAddr, fc.RedisAddr)
+	setString(&config.SecretKey, fc.SecretKey)
+	setString(&config.ShortPathGenerator, fc.ShortPathGenerator)
+	setString(&config.TLSCertFile, fc.TLSCertFile)
+	setString(&config.TLSKeyFile, fc.TLSKeyFile)
+	setString(&config.FileSync, fc.FileSync)
+	setString(&config.FileDurability, fc.FileDurability)
+	setString(&config.Storage, fc.Storage)
+	setString(&config.GRPCAddress, fc.GRPCAddress)
+	setString(&config.TrustedSubnet, fc.TrustedSubnet)
+	setString(&config.TraceOutput, fc.TraceOutput)
+	if fc.EnableHTTPS != nil {
+		config.EnableHTTPS = *fc.EnableHTTPS
+	}
+	if fc.MigrationsFailFast != nil {
+		config.MigrationsFailFast = *fc.MigrationsFailFast
+	}
+	if fc.FileQueueSize != nil {
+		config.FileQueueSize = *fc.FileQueueSize
+	}
+	if fc.FileFlushSize != nil {
+		config.FileFlushSize = *fc.FileFlushSize
+	}
+	if fc.CacheSize != nil {
+		config.CacheSize = *fc.CacheSize
+	}
+	setInt(&config.RateLimitCreate, fc.RateLimitCreate)
+	setInt(&config.RateLimitCreateBurst, fc.RateLimitCreateBurst)
+	setInt(&config.RateLimitBatch, fc.RateLimitBatch)
+	setInt(&config.RateLimitBatchBurst, fc.RateLimitBatchBurst)
+	setInt(&config.RateLimitRedirect, fc.RateLimitRedirect)
+	setInt(&config.RateLimitRedirectBurst, fc.RateLimitRedirectBurst)
+	setInt(&config.URLMaxLength, fc.URLMaxLength)
+	if fc.TrustedProxies != nil {
+		config.TrustedProxies = fc.TrustedProxies
+	}
+	if fc.URLAllowedSchemes != nil {
+		config.URLAllowedSchemes = fc.URLAllowedSchemes
+	}
+	if fc.URLAllowedDomains != nil {
+		config.URLAllowedDomains = fc.URLAllowedDomains
+	}
+	if fc.URLDeniedDomains != nil {
+		config.URLDeniedDomains = fc.URLDeniedDomains
+	}
+	if fc.URLAllowPrivateHosts != nil {
+		config.URLAllowPrivateHosts = *fc.URLAllowPrivateHosts
+	}
+
+	if err := setDuration(&config.ExpirySweepInterval, fc.ExpirySweepInterval, "expiry_sweep_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.ShutdownTimeout, fc.ShutdownTimeout, "shutdown_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.DBQueryTimeout, fc.DBQueryTimeout, "db_query_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.CacheTTL, fc.CacheTTL, "cache_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.CacheNegativeTTL, fc.CacheNegativeTTL, "cache_negative_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.RateLimitIdleTTL, fc.RateLimitIdleTTL, "rate_limit_idle_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.FileSyncInterval, fc.FileSyncInterval, "file_sync_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&config.FileCompactInterval, fc.FileCompactInterval, "file_compact_interval"); err != nil {
+		return err
+	}
+	return setDuration(&config.FileFlushInterval, fc.FileFlushInterval, "file_flush_interval")
+}
+
+func setString(dst *string, value *string) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setInt(dst *int, value *int) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setDuration(dst *time.Duration, value *string, key string) error {
+	if value == nil {
+		return nil
+	}
+	d, err := time.ParseDuration(*value)
+	if err != nil {
+		return fmt.Errorf("invalid %s in config file: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// shortPathGenerators допустимые значения ShortPathGenerator.
+var shortPathGenerators = []string{"hash", "random", "sequential"}
+
+// fileSyncModes допустимые значения FileSync.
+var fileSyncModes = []string{"always", "interval", "never"}
+
+// storageKinds допустимые значения Storage.
+var storageKinds = []string{"auto", "postgres", "redis", "embedded", "file", "memory"}
+
+// logFormats допустимые значения LogFormat.
+var logFormats = []string{"console", "json"}
+
+// fileDurabilityModes допустимые значения FileDurability.
+var fileDurabilityModes = []string{"sync", "async"}
+
+// FieldError описывает некорректное значение одного поля конфигурации.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError содержит все найденные ошибки конфигурации.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid configuration:")
+	for _, f := range e.Fields {
+		fmt.Fprintf(&sb, "\n  - %s: %s", f.Field, f.Message)
+	}
+	return sb.String()
+}
+
+// Validate проверяет итоговую конфигурацию и возвращает *ValidationError
+// со списком всех некорректных полей.
+func Validate(config *Config) error {
+	var fields []FieldError
+	add := func(field, format string, args ...any) {
+		fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := validateAddress(config.Address); err != nil {
+		add("server_address", "%v", err)
+	}
+	if config.GRPCAddress != "" {
+		if err := validateAddress(config.GRPCAddress); err != nil {
+			add("grpc_address", "%v", err)
+		}
+	}
+	if err := validateBaseURL(config.ReturningAddress); err != nil {
+		add("base_url", "%v", err)
+	}
+	if _, err := zapcore.ParseLevel(config.LogLevel); err != nil {
+		add("log_level", "unknown level %q", config.LogLevel)
+	}
+	if !slices.Contains(logFormats, config.LogFormat) {
+		add("log_format", "must be one of %s", strings.Join(logFormats, ", "))
+	}
+	if config.SecretKey == publicSecretKey {
+		add("secret_key", "must not be the publicly known former default, set a random value")
+	}
+	if !slices.Contains(shortPathGenerators, config.ShortPathGenerator) {
+		add("short_path_generator", "must be one of %s", strings.Join(shortPathGenerators, ", "))
+	}
+	switch {
+	case !slices.Contains(storageKinds, config.Storage):
+		add("storage", "must be one of %s", strings.Join(storageKinds, ", "))
+	case config.Storage == "postgres" && config.DatabaseDSN == "":
+		add("database_dsn", "is required for postgres storage")
+	case config.Storage == "redis" && config.RedisAddr == "":
+		add("redis_addr", "is required for redis storage")
+	case (config.Storage == "file" || config.Storage == "embedded") && config.FilePath == "":
+		add("file_storage_path", "is required for %s storage", config.Storage)
+	}
+	if !slices.Contains(fileSyncModes, config.FileSync) {
+		add("file_sync", "must be one of %s", strings.Join(fileSyncModes, ", "))
+	}
+	if config.FileSync == "interval" && config.FileSyncInterval <= 0 {
+		add("file_sync_interval", "must be positive in interval mode")
+	}
+	if config.FileCompactInterval < 0 {
+		add("file_compact_interval", "must not be negative")
+	}
+	if !slices.Contains(fileDurabilityModes, config.FileDurability) {
+		add("file_durability", "must be one of %s", strings.Join(fileDurabilityModes, ", "))
+	}
+	if config.FileDurability == "async" {
+		if config.FileQueueSize <= 0 {
+			add("file_queue_size", "must be positive")
+		}
+		if config.FileFlushSize <= 0 || config.FileFlushSize > config.FileQueueSize {
+			add("file_flush_size", "must be positive and not greater than file_queue_size")
+		}
+		if config.FileFlushInterval <= 0 {
+			add("file_flush_interval", "must be positive")
+		}
+	}
+	if config.ExpirySweepInterval < 0 {
+		add("expiry_sweep_interval", "must not be negative")
+	}
+	if config.ShutdownTimeout <= 0 {
+		add("shutdown_timeout", "must be positive")
+	}
+	if config.DBQueryTimeout < 0 {
+		add("db_query_timeout", "must not be negative")
+	}
+	for _, limit := range []struct {
+		field string
+		rate  int
+		burst int
+	}{
+		{"rate_limit_create", config.RateLimitCreate, config.RateLimitCreateBurst},
+		{"rate_limit_batch", config.RateLimitBatch, config.RateLimitBatchBurst},
+		{"rate_limit_redirect", config.RateLimitRedirect, config.RateLimitRedirectBurst},
+	} {
+		if limit.rate < 0 {
+			add(limit.field, "must not be negative")
+		}
+		if limit.rate > 0 && limit.burst <= 0 {
+			add(limit.field+"_burst", "must be positive when %s is set", limit.field)
+		}
+	}
+	if config.RateLimitIdleTTL <= 0 {
+		add("rate_limit_idle_ttl", "must be positive")
+	}
+	if len(config.URLAllowedSchemes) == 0 {
+		add("url_allowed_schemes", "must not be empty")
+	}
+	for _, scheme := range config.URLAllowedSchemes {
+		if !validScheme(scheme) {
+			add("url_allowed_schemes", "invalid scheme %q", scheme)
+		}
+	}
+	for _, list := range []struct {
+		field   string
+		domains []string
+	}{
+		{"url_allowed_domains", config.URLAllowedDomains},
+		{"url_denied_domains", config.URLDeniedDomains},
+	} {
+		for _, domain := range list.domains {
+			if !validDomainPattern(domain) {
+				add(list.field, "expected domain or *.domain, got %q", domain)
+			}
+		}
+	}
+	if config.URLMaxLength <= 0 {
+		add("url_max_length", "must be positive")
+	}
+	if config.CacheSize < 0 {
+		add("cache_size", "must not be negative")
+	}
+	if config.CacheTTL < 0 {
+		add("cache_ttl", "must not be negative")
+	}
+	if config.CacheNegativeTTL < 0 {
+		add("cache_negative_ttl", "must not be negative")
+	}
+	if config.TrustedSubnet != "" {
+		if _, err := netip.ParsePrefix(config.TrustedSubnet); err != nil {
+			add("trusted_subnet", "expected CIDR, got %q", config.TrustedSubnet)
+		}
+	}
+	for _, proxy := range config.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				add("trusted_proxies", "expected IP or CIDR, got %q", proxy)
+			}
+		}
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		add("tls_cert_file", "tls_cert_file and tls_key_file must be set together")
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("expected host:port, got %q", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q: %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", baseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host is missing in %q", baseURL)
+	}
+	return nil
+}
+
+// validScheme проверяет синтаксис схемы URL по RFC 3986: буква, затем буквы, цифры, '+', '-' или '.'.
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, r := range scheme {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validDomainPattern принимает домен или шаблон *.domain. Звездочка допускается только
+// как первый элемент шаблона.
+func validDomainPattern(pattern string) bool {
+	domain := strings.TrimPrefix(pattern, "*.")
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return false
+	}
+	return !strings.ContainsAny(domain, "*/:@ \t")
+}
@@ -0,0 +1,52 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type userKey struct{}
+
+type user struct {
+	id            string
+	authenticated bool
+}
+
+// AuthInterceptor идентифицирует пользователя по подписанному токену в метаданных user_id,
+// как это делает cookie в HTTP API. Если токен отсутствует или подпись неверна,
+// пользователю выдается новый идентификатор, а токен возвращается в заголовке ответа.
+func AuthInterceptor(signer *auth.Signer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			for _, token := range md.Get(auth.CookieName) {
+				if userID, ok := signer.Verify(token); ok {
+					return handler(context.WithValue(ctx, userKey{}, user{id: userID, authenticated: true}), req)
+				}
+			}
+		}
+
+		userID, err := auth.NewUserID()
+		if err != nil {
+			logger.Log.Error("Failed to generate user ID", zap.Error(err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(auth.CookieName, signer.Sign(userID))); err != nil {
+			logger.Log.Error("Failed to set user token header", zap.Error(err))
+		}
+
+		return handler(context.WithValue(ctx, userKey{}, user{id: userID}), req)
+	}
+}
+
+// userFromContext возвращает пользователя, определенного AuthInterceptor.
+func userFromContext(ctx context.Context) user {
+	u, _ := ctx.Value(userKey{}).(user)
+	return u
+}
@@ -0,0 +1,54 @@
+package grpcserver
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	pb "github.com/MaxRadzey/shortener/internal/proto"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimitInterceptor ограничивает частоту вызовов теми же ограничителями, что и HTTP API:
+// Shorten расходует лимит создания, ShortenBatch — пакетного создания, Expand — переходов.
+// Как и в HTTP, каждый вызов расходует лимит адреса клиента, а вызов с валидным токеном —
+// еще и лимит пользователя. Вызов сверх лимита получает ResourceExhausted и заголовок
+// retry-after. Перехватчик подключается после AuthInterceptor.
+func RateLimitInterceptor(limits *ratelimit.Limits) grpc.UnaryServerInterceptor {
+	byMethod := map[string]*ratelimit.Limiter{
+		pb.Shortener_Shorten_FullMethodName:      limits.Create,
+		pb.Shortener_ShortenBatch_FullMethodName: limits.Batch,
+		pb.Shortener_Expand_FullMethodName:       limits.Redirect,
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		limiter := byMethod[info.FullMethod]
+		if limiter == nil {
+			return handler(ctx, req)
+		}
+
+		keys := []string{"ip:" + peerIP(ctx)}
+		if u := userFromContext(ctx); u.authenticated {
+			keys = append(keys, "user:"+u.id)
+		}
+		for _, key := range keys {
+			allowed, retryAfter := limiter.Allow(key)
+			if allowed {
+				continue
+			}
+			logger.FromContext(ctx).Debug("Rate limit exceeded", zap.String("key", key))
+			retry := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+			if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", retry)); err != nil {
+				logger.Log.Error("Failed to set retry-after header", zap.Error(err))
+			}
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
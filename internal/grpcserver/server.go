@@ -0,0 +1,209 @@
+// Package grpcserver реализует gRPC API сервиса поверх service.Service,
+// поэтому валидация и обработка конфликтов совпадают с HTTP API.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/models"
+	pb "github.com/MaxRadzey/shortener/internal/proto"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/MaxRadzey/shortener/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server обработчик gRPC запросов.
+type Server struct {
+	pb.UnimplementedShortenerServer
+
+	Service *service.Service
+}
+
+// New создает gRPC сервер с зарегистрированным сервисом Shortener, проверкой токена пользователя
+// и ограничением частоты вызовов по limits, общим с HTTP API.
+func New(urlService *service.Service, signer *auth.Signer, limits *ratelimit.Limits, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(AuthInterceptor(signer), RateLimitInterceptor(limits)))
+	server := grpc.NewServer(opts...)
+	pb.RegisterShortenerServer(server, &Server{Service: urlService})
+	return server
+}
+
+// Shorten сокращает URL. Если URL уже сокращен, возвращает AlreadyExists
+// с существующим коротким URL в сообщении.
+func (s *Server) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	result, err := s.Service.CreateShortURL(ctx, req.GetUrl(), userFromContext(ctx).id, service.CreateOptions{
+		Alias:      req.GetAlias(),
+		ExpiresAt:  timeFromProto(req.GetExpiresAt()),
+		TTLSeconds: req.GetTtlSeconds(),
+	})
+	if err != nil {
+		return nil, toStatus(err, "Failed to create URL")
+	}
+
+	return &pb.ShortenResponse{ShortUrl: result}, nil
+}
+
+// ShortenBatch сокращает несколько URL за один запрос.
+func (s *Server) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+
+	items := make([]models.BatchRequestItem, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		items = append(items, models.BatchRequestItem{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			Alias:         item.GetAlias(),
+			ExpiresAt:     timeFromProto(item.GetExpiresAt()),
+			TTLSeconds:    item.GetTtlSeconds(),
+		})
+	}
+
+	results, err := s.Service.CreateShortURLBatch(ctx, items, userFromContext(ctx).id)
+	if err != nil {
+		return nil, toStatus(err, "Failed to create batch URLs")
+	}
+
+	resp := &pb.ShortenBatchResponse{Items: make([]*pb.BatchResponseItem, 0, len(results))}
+	for _, result := range results {
+		resp.Items = append(resp.Items, &pb.BatchResponseItem{
+			CorrelationId: result.CorrelationID,
+			ShortUrl:      result.ShortURL,
+			Status:        result.Status,
+		})
+	}
+	return resp, nil
+}
+
+// Expand возвращает исходный URL по короткому пути и учитывает переход в статистике.
+func (s *Server) Expand(ctx context.Context, req *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	longURL, err := s.Service.GetLongURL(ctx, req.GetShortPath())
+	if err != nil {
+		return nil, toStatus(err, "Failed to get URL")
+	}
+
+	s.Service.RecordClick(req.GetShortPath(), clickInfo(ctx))
+
+	return &pb.ExpandResponse{OriginalUrl: longURL}, nil
+}
+
+// ListUserURLs возвращает ссылки текущего пользователя.
+// Без валидного токена возвращает Unauthenticated.
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	u := userFromContext(ctx)
+	if !u.authenticated {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	items, err := s.Service.GetUserURLs(ctx, u.id)
+	if err != nil {
+		return nil, toStatus(err, "Failed to get user URLs")
+	}
+
+	resp := &pb.ListUserURLsResponse{Urls: make([]*pb.UserURL, 0, len(items))}
+	for _, item := range items {
+		resp.Urls = append(resp.Urls, &pb.UserURL{ShortUrl: item.ShortURL, OriginalUrl: item.OriginalURL})
+	}
+	return resp, nil
+}
+
+// DeleteUserURLs ставит ссылки текущего пользователя в очередь на удаление.
+// Без валидного токена возвращает Unauthenticated.
+func (s *Server) DeleteUserURLs(ctx context.Context, req *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	u := userFromContext(ctx)
+	if !u.authenticated {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	if err := s.Service.DeleteUserURLs(ctx, u.id, req.GetShortPaths()); err != nil {
+		return nil, toStatus(err, "Failed to enqueue URLs deletion")
+	}
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+// Ping проверяет соединение с базой данных.
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.Service.Ping(ctx); err != nil {
+		logger.Log.Error("Failed to ping database", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "database connection failed")
+	}
+	return &pb.PingResponse{}, nil
+}
+
+// toStatus преобразует ошибку сервиса в gRPC статус. Неизвестные ошибки логируются
+// с сообщением msg и возвращаются клиенту как Internal.
+func toStatus(err error, msg string) error {
+	var validationErr *service.ErrValidation
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	}
+	var aliasErr *service.ErrAliasConflict
+	if errors.As(err, &aliasErr) {
+		return status.Error(codes.AlreadyExists, "alias already taken")
+	}
+	var conflictErr *service.ErrURLConflict
+	if errors.As(err, &conflictErr) {
+		return status.Error(codes.AlreadyExists, conflictErr.ShortURL)
+	}
+
+	switch {
+	case errors.Is(err, service.ErrURLNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, service.ErrURLDeleted), errors.Is(err, service.ErrURLExpired):
+		return status.Error(codes.NotFound, "gone")
+	case errors.Is(err, service.ErrShuttingDown):
+		return status.Error(codes.Unavailable, "service unavailable")
+	}
+
+	logger.Log.Error(msg, zap.Error(err))
+	return status.Error(codes.Internal, "internal error")
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// clickInfo собирает сведения о переходе из метаданных и адреса клиента.
+func clickInfo(ctx context.Context) service.ClickInfo {
+	var info service.ClickInfo
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			info.UserAgent = values[0]
+		}
+		if values := md.Get("referer"); len(values) > 0 {
+			info.Referrer = values[0]
+		}
+	}
+	info.IP = peerIP(ctx)
+	return info
+}
+
+// peerIP возвращает адрес клиента без порта. gRPC принимает соединения напрямую,
+// поэтому заголовки прокси не учитываются.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -7,8 +7,11 @@ import (
 	"net/http"
 
 	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/metrics"
+	"github.com/MaxRadzey/shortener/internal/middleware"
 	"github.com/MaxRadzey/shortener/internal/models"
 	"github.com/MaxRadzey/shortener/internal/service"
+	"github.com/MaxRadzey/shortener/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -22,7 +25,7 @@ func (h *Handler) sendJSONResponse(c *gin.Context, statusCode int, data interfac
 	c.Writer.Header().Set("Content-Type", "application/json")
 	c.Writer.WriteHeader(statusCode)
 	if err := json.NewEncoder(c.Writer).Encode(data); err != nil {
-		logger.Log.Error("Failed to encode JSON response", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to encode JSON response", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Internal server error!")
 	}
 }
@@ -31,20 +34,22 @@ func (h *Handler) sendJSONResponse(c *gin.Context, statusCode int, data interfac
 // создает короткий путь и возвращает ег ов виде строки с полным URL.
 // Ожидается Content-Type: text/plain
 func (h *Handler) CreateURL(c *gin.Context) {
+	_, span := tracing.Start(c.Request.Context(), "handler.readBody")
 	body, err := io.ReadAll(c.Request.Body)
+	span.End()
 	if err != nil {
-		logger.Log.Error("Failed to create URL", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to create URL", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Error occurred while reading body!")
 		return
 	}
 
 	text := string(body)
 
-	result, err := h.Service.CreateShortURL(text)
+	result, err := h.Service.CreateShortURL(c.Request.Context(), text, middleware.UserID(c), service.CreateOptions{})
 	if err != nil {
 		var validationErr *service.ErrValidation
 		if errors.As(err, &validationErr) {
-			c.String(http.StatusBadRequest, "Invalid Body!")
+			c.String(http.StatusBadRequest, validationErr.Error())
 			return
 		}
 		// Проверяем, является ли ошибка конфликтом существующего URL
@@ -54,7 +59,7 @@ func (h *Handler) CreateURL(c *gin.Context) {
 			c.String(http.StatusConflict, conflictErr.ShortURL)
 			return
 		}
-		logger.Log.Error("Failed to create URL", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to create URL", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Internal server error!")
 		return
 	}
@@ -65,31 +70,57 @@ func (h *Handler) CreateURL(c *gin.Context) {
 
 // GetURL хэндлер, обрабатывает GET-запросы, получает в качестве параметра маршрута сокращенное значение URL,
 // ищет в БД совпадение длинного пути и производит редирект на него (307), иначе отдает (404) ошибку.
+// Для удаленных ссылок и ссылок с истекшим сроком действия возвращает (410).
 func (h *Handler) GetURL(c *gin.Context) {
 	shortPath := c.Param("short_path")
-	longURL, err := h.Service.GetLongURL(shortPath)
+	longURL, err := h.Service.GetLongURL(c.Request.Context(), shortPath)
 
 	if err != nil {
+		if errors.Is(err, service.ErrURLDeleted) || errors.Is(err, service.ErrURLExpired) {
+			metrics.ObserveRedirect(metrics.RedirectGone)
+			c.String(http.StatusGone, "Gone!")
+			return
+		}
+		metrics.ObserveRedirect(metrics.RedirectMiss)
 		c.String(http.StatusNotFound, "Not found!")
 		return
 	}
 
+	metrics.ObserveRedirect(metrics.RedirectHit)
+	h.Service.RecordClick(shortPath, service.ClickInfo{
+		Referrer:  c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+
 	c.Redirect(http.StatusTemporaryRedirect, longURL)
 }
 
 func (h *Handler) GetURLJSON(c *gin.Context) {
 	var req models.Request
 
-	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+	_, span := tracing.Start(c.Request.Context(), "handler.decodeRequest")
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	span.End()
+	if err != nil {
 		c.String(http.StatusBadRequest, "invalid request")
 		return
 	}
 
-	result, err := h.Service.CreateShortURL(req.URL)
+	result, err := h.Service.CreateShortURL(c.Request.Context(), req.URL, middleware.UserID(c), service.CreateOptions{
+		Alias:      req.Alias,
+		ExpiresAt:  req.ExpiresAt,
+		TTLSeconds: req.TTLSeconds,
+	})
 	if err != nil {
 		var validationErr *service.ErrValidation
 		if errors.As(err, &validationErr) {
-			c.String(http.StatusBadRequest, "invalid request")
+			c.String(http.StatusBadRequest, validationErr.Error())
+			return
+		}
+		var aliasErr *service.ErrAliasConflict
+		if errors.As(err, &aliasErr) {
+			c.String(http.StatusConflict, "alias already taken")
 			return
 		}
 		// Проверяем, является ли ошибка конфликтом существующего URL
@@ -99,7 +130,7 @@ func (h *Handler) GetURLJSON(c *gin.Context) {
 			h.sendJSONResponse(c, http.StatusConflict, resp)
 			return
 		}
-		logger.Log.Error("Failed to get URL", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to get URL", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Internal server error!")
 		return
 	}
@@ -110,10 +141,21 @@ func (h *Handler) GetURLJSON(c *gin.Context) {
 
 // Ping хендлер проверяет соединение с базой данных.
 // Возвращает HTTP 200 OK при успешной проверке, 500 Internal Server Error при неуспешной.
+// С параметром details=true возвращает JSON с активным хранилищем и состоянием БД.
 func (h *Handler) Ping(c *gin.Context) {
 	ctx := c.Request.Context()
+	if c.Query("details") == "true" {
+		status := h.Service.PingDetails(ctx)
+		code := http.StatusOK
+		if status.Status != "ok" {
+			code = http.StatusInternalServerError
+		}
+		h.sendJSONResponse(c, code, status)
+		return
+	}
+
 	if err := h.Service.Ping(ctx); err != nil {
-		logger.Log.Error("Failed to ping database", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to ping database", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Database connection failed")
 		return
 	}
@@ -123,11 +165,16 @@ func (h *Handler) Ping(c *gin.Context) {
 
 // CreateURLBatch хендлер обрабатывает POST-запросы,
 // принимает массив объектов с correlation_id и original_url,
-// создает короткие URL для всех URL и возвращает массив объектов с correlation_id и short_url.
+// создает короткие URL для всех URL и возвращает массив объектов с correlation_id, short_url и status.
+// Для уже сокращенных URL возвращается существующая ссылка со статусом conflict;
+// если новых ссылок в пачке нет, ответ приходит с кодом 409.
 func (h *Handler) CreateURLBatch(c *gin.Context) {
 	var reqItems []models.BatchRequestItem
 
-	if err := json.NewDecoder(c.Request.Body).Decode(&reqItems); err != nil {
+	_, span := tracing.Start(c.Request.Context(), "handler.decodeRequest")
+	err := json.NewDecoder(c.Request.Body).Decode(&reqItems)
+	span.End()
+	if err != nil {
 		c.String(http.StatusBadRequest, "invalid request")
 		return
 	}
@@ -138,17 +185,105 @@ func (h *Handler) CreateURLBatch(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	responseItems, err := h.Service.CreateShortURLBatch(ctx, reqItems)
+	responseItems, err := h.Service.CreateShortURLBatch(ctx, reqItems, middleware.UserID(c))
 	if err != nil {
 		var validationErr *service.ErrValidation
 		if errors.As(err, &validationErr) {
-			c.String(http.StatusBadRequest, "invalid request")
+			c.String(http.StatusBadRequest, validationErr.Error())
+			return
+		}
+		var aliasErr *service.ErrAliasConflict
+		if errors.As(err, &aliasErr) {
+			c.String(http.StatusConflict, "alias already taken")
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("Failed to create batch URLs", zap.Error(err))
+		c.String(http.StatusInternalServerError, "Internal server error!")
+		return
+	}
+
+	code := http.StatusConflict
+	for _, item := range responseItems {
+		if item.Status == models.BatchStatusCreated {
+			code = http.StatusCreated
+			break
+		}
+	}
+	h.sendJSONResponse(c, code, responseItems)
+}
+
+// GetUserURLs хендлер возвращает все сокращенные URL текущего пользователя.
+// Возвращает 401, если запрос пришел без валидной cookie, и 204, если ссылок нет.
+func (h *Handler) GetUserURLs(c *gin.Context) {
+	if !middleware.IsAuthenticated(c) {
+		c.String(http.StatusUnauthorized, "Unauthorized!")
+		return
+	}
+
+	items, err := h.Service.GetUserURLs(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to get user URLs", zap.Error(err))
+		c.String(http.StatusInternalServerError, "Internal server error!")
+		return
+	}
+
+	if len(items) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	h.sendJSONResponse(c, http.StatusOK, items)
+}
+
+// DeleteUserURLs хендлер принимает массив коротких идентификаторов и ставит
+// ссылки текущего пользователя в очередь на удаление. Сразу возвращает 202.
+func (h *Handler) DeleteUserURLs(c *gin.Context) {
+	if !middleware.IsAuthenticated(c) {
+		c.String(http.StatusUnauthorized, "Unauthorized!")
+		return
+	}
+
+	var shortPaths []string
+	if err := json.NewDecoder(c.Request.Body).Decode(&shortPaths); err != nil {
+		c.String(http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	if err := h.Service.DeleteUserURLs(c.Request.Context(), middleware.UserID(c), shortPaths); err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to enqueue URLs deletion", zap.Error(err))
+		c.String(http.StatusServiceUnavailable, "Service unavailable!")
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// GetURLStats хендлер возвращает статистику переходов по короткой ссылке:
+// общее количество, число уникальных посетителей и распределение по дням.
+func (h *Handler) GetURLStats(c *gin.Context) {
+	stats, err := h.Service.GetURLStats(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrURLNotFound) {
+			c.String(http.StatusNotFound, "Not found!")
 			return
 		}
-		logger.Log.Error("Failed to create batch URLs", zap.Error(err))
+		logger.FromContext(c.Request.Context()).Error("Failed to get URL stats", zap.Error(err))
+		c.String(http.StatusInternalServerError, "Internal server error!")
+		return
+	}
+
+	h.sendJSONResponse(c, http.StatusOK, stats)
+}
+
+// GetInternalStats хендлер возвращает количество сокращенных ссылок и пользователей.
+// Доступ ограничен доверенной подсетью на уровне middleware.
+func (h *Handler) GetInternalStats(c *gin.Context) {
+	stats, err := h.Service.GetInternalStats(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to get internal stats", zap.Error(err))
 		c.String(http.StatusInternalServerError, "Internal server error!")
 		return
 	}
 
-	h.sendJSONResponse(c, http.StatusCreated, responseItems)
+	h.sendJSONResponse(c, http.StatusOK, stats)
 }
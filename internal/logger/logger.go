@@ -1,44 +1,35 @@
 package logger
 
 import (
-	"time"
+	"context"
 
-	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-var Log *zap.Logger = zap.NewNop()
-
-type (
-	responseData struct {
-		status int
-		size   int
-	}
-
-	loggingResponseWriter struct {
-		gin.ResponseWriter
-		responseData *responseData
-	}
+// Форматы вывода лога.
+const (
+	// FormatConsole человекочитаемый вывод для разработки.
+	FormatConsole = "console"
+	// FormatJSON JSON-записи production-конфигурации zap для сборщиков логов.
+	FormatJSON = "json"
 )
 
-func (r *loggingResponseWriter) Write(b []byte) (int, error) {
-	size, err := r.ResponseWriter.Write(b)
-	r.responseData.size += size
-	return size, err
-}
+var Log *zap.Logger = zap.NewNop()
 
-func (r *loggingResponseWriter) WriteHeader(statusCode int) {
-	r.ResponseWriter.WriteHeader(statusCode)
-	r.responseData.status = statusCode
-}
+type requestIDKey struct{}
 
-func Initialize(level string) error {
+// Initialize настраивает глобальный логгер с уровнем level и форматом format.
+func Initialize(level, format string) error {
 	lvl, err := zap.ParseAtomicLevel(level)
 	if err != nil {
 		return err
 	}
 
 	cfg := zap.NewDevelopmentConfig()
+	if format == FormatJSON {
+		cfg = zap.NewProductionConfig()
+	}
 	cfg.Level = lvl
 
 	zl, err := cfg.Build()
@@ -50,38 +41,32 @@ func Initialize(level string) error {
 	return nil
 }
 
-func RequestLogger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-
-		c.Next()
-
-		duration := time.Since(start)
-		Log.Info("got incoming HTTP request",
-			zap.String("URI", c.Request.RequestURI),
-			zap.String("method", c.Request.Method),
-			zap.Duration("duration", duration),
-		)
-	}
+// WithRequestID сохраняет идентификатор запроса в контексте для FromContext.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
 }
 
-func ResponseLogger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		responseData := &responseData{
-			status: 0,
-			size:   0,
-		}
-
-		lw := &loggingResponseWriter{
-			ResponseWriter: c.Writer,
-			responseData:   responseData,
-		}
-		c.Writer = lw
-		c.Next()
+// RequestIDFromContext возвращает идентификатор запроса, сохраненный WithRequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
 
-		Log.Info("response",
-			zap.Int("status", lw.responseData.status),
-			zap.Int("size", lw.responseData.size),
+// FromContext возвращает логгер с идентификатором запроса и идентификаторами трассы
+// и спана из ctx, чтобы записи лога можно было сопоставить с запросом и его трассой.
+func FromContext(ctx context.Context) *zap.Logger {
+	var fields []zap.Field
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		fields = append(fields, zap.String("request_id", requestID))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
 		)
 	}
+	if len(fields) == 0 {
+		return Log
+	}
+	return Log.With(fields...)
 }
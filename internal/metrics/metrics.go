@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Результаты редиректа по короткой ссылке.
+const (
+	// RedirectHit ссылка найдена, выполнен редирект.
+	RedirectHit = "hit"
+	// RedirectMiss ссылка не найдена.
+	RedirectMiss = "miss"
+	// RedirectGone ссылка удалена или истекла.
+	RedirectGone = "gone"
+)
+
+// unmatchedRoute метка маршрута для запросов, не попавших ни в один маршрут gin.
+// Исходный путь не используется, чтобы случайные адреса не раздували число серий.
+const unmatchedRoute = "unmatched"
+
+// otherMethod метка для нестандартных HTTP методов: метод задает клиент, и произвольные
+// значения раздували бы число серий так же, как исходные пути.
+const otherMethod = "other"
+
+// knownMethods методы, которые попадают в метку method как есть.
+var knownMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodConnect: {},
+	http.MethodOptions: {},
+	http.MethodTrace:   {},
+}
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Количество HTTP запросов по маршрутам и кодам ответа.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки HTTP запроса.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Количество обращений к коротким ссылкам по результату.",
+	}, []string{"result"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Время выполнения операций хранилища ссылок.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+	}, []string{"backend", "operation"})
+
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "errors_total",
+		Help:      "Количество сбоев операций хранилища ссылок.",
+	}, []string{"backend", "operation"})
+
+	pool = &poolCollector{}
+
+	registry = prometheus.NewRegistry()
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		redirects,
+		storageDuration,
+		storageErrors,
+		pool,
+	)
+}
+
+// Handler отдает метрики в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware считает HTTP запросы и время их обработки по шаблону маршрута gin.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		if _, ok := knownMethods[method]; !ok {
+			method = otherMethod
+		}
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveRedirect учитывает обращение к короткой ссылке.
+func ObserveRedirect(result string) {
+	redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveStorage учитывает операцию хранилища, начатую в момент start.
+// failed означает сбой хранилища, а не ожидаемый ответ вроде «ссылка не найдена».
+func ObserveStorage(backend, operation string, start time.Time, failed bool) {
+	storageDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if failed {
+		storageErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+// SetPool подключает пул соединений PostgreSQL к метрикам. nil отключает метрики пула.
+func SetPool(db *pgxpool.Pool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.db = db
+}
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc(namespace+"_db_pool_acquired_conns",
+		"Количество соединений, выданных из пула.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc(namespace+"_db_pool_idle_conns",
+		"Количество простаивающих соединений пула.", nil, nil)
+	poolTotalDesc = prometheus.NewDesc(namespace+"_db_pool_total_conns",
+		"Общее количество соединений пула.", nil, nil)
+	poolMaxDesc = prometheus.NewDesc(namespace+"_db_pool_max_conns",
+		"Максимальный размер пула.", nil, nil)
+	poolAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Количество успешных получений соединения из пула.", nil, nil)
+	poolEmptyAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Количество получений соединения, которым пришлось ждать или открывать новое соединение.", nil, nil)
+	poolCanceledAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Количество получений соединения, прерванных отменой контекста.", nil, nil)
+	poolAcquireDurationDesc = prometheus.NewDesc(namespace+"_db_pool_acquire_duration_seconds_total",
+		"Суммарное время ожидания соединения из пула.", nil, nil)
+)
+
+// poolCollector читает статистику pgxpool в момент сбора метрик.
+type poolCollector struct {
+	mu sync.Mutex
+	db *pgxpool.Pool
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredDesc
+	ch <- poolIdleDesc
+	ch <- poolTotalDesc
+	ch <- poolMaxDesc
+	ch <- poolAcquiresDesc
+	ch <- poolEmptyAcquiresDesc
+	ch <- poolCanceledAcquiresDesc
+	ch <- poolAcquireDurationDesc
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	db := p.db
+	p.mu.Unlock()
+	if db == nil {
+		return
+	}
+
+	stat := db.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquiresDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDurationDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	userIDKey        = "userID"
+	authenticatedKey = "userAuthenticated"
+
+	// cookieMaxAge время жизни cookie с идентификатором пользователя (один год).
+	cookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// Auth идентифицирует пользователя по подписанной cookie.
+// Если cookie отсутствует или подпись неверна, пользователю выдается новый идентификатор.
+// secure помечает выдаваемую cookie атрибутом Secure, когда сервер работает по HTTPS.
+func Auth(signer *auth.Signer, secure bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := c.Cookie(auth.CookieName); err == nil {
+			if userID, ok := signer.Verify(token); ok {
+				c.Set(userIDKey, userID)
+				c.Set(authenticatedKey, true)
+				c.Next()
+				return
+			}
+		}
+
+		userID, err := auth.NewUserID()
+		if err != nil {
+			logger.Log.Error("Failed to generate user ID", zap.Error(err))
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.SetCookie(auth.CookieName, signer.Sign(userID), cookieMaxAge, "/", "", secure, true)
+		c.Set(userIDKey, userID)
+		c.Set(authenticatedKey, false)
+		c.Next()
+	}
+}
+
+// UserID возвращает идентификатор пользователя текущего запроса.
+func UserID(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
+
+// IsAuthenticated сообщает, пришел ли запрос с валидной cookie пользователя.
+func IsAuthenticated(c *gin.Context) bool {
+	return c.GetBool(authenticatedKey)
+}
@@ -2,11 +2,12 @@ package middleware
 
 import (
 	"compress/gzip"
-	"log"
 	"net/http"
 	"strings"
 
+	"github.com/MaxRadzey/shortener/internal/logger"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 type compressWriter struct {
@@ -29,23 +30,25 @@ func (c *compressWriter) WriteString(s string) (int, error) {
 // Gzip обрабатывает сжатие и распаковку gzip для HTTP запросов и ответов.
 func Gzip() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		log := logger.FromContext(c.Request.Context())
 		acceptEncoding := c.GetHeader("Accept-Encoding")
-		log.Printf("[GzipMiddleware] Accept-Encoding: %s", acceptEncoding)
+		contentEncoding := c.GetHeader("Content-Encoding")
+		log.Debug("Gzip negotiation",
+			zap.String("accept_encoding", acceptEncoding),
+			zap.String("content_encoding", contentEncoding))
 		supportGzip := strings.Contains(acceptEncoding, "gzip")
 
 		if supportGzip {
 			gz := gzip.NewWriter(c.Writer)
 			defer func() {
 				if err := gz.Close(); err != nil {
-					log.Printf("[GzipMiddleware] Error closing gzip writer: %v", err)
+					log.Error("Failed to close gzip writer", zap.Error(err))
 				}
 			}()
 			c.Writer = &compressWriter{Writer: gz, ResponseWriter: c.Writer}
 			c.Header("Content-Encoding", "gzip")
 		}
 
-		contentEncoding := c.GetHeader("Content-Encoding")
-		log.Printf("[GzipMiddleware] Content-Encoding: %s", contentEncoding)
 		sendGzip := strings.Contains(contentEncoding, "gzip")
 
 		if sendGzip {
@@ -57,12 +60,11 @@ func Gzip() gin.HandlerFunc {
 
 			defer func() {
 				if err := reader.Close(); err != nil {
-					log.Printf("[GzipMiddleware] Error closing gzip reader: %v", err)
+					log.Error("Failed to close gzip reader", zap.Error(err))
 				}
 			}()
 			c.Request.Body = reader
 		}
 		c.Next()
-		log.Printf("[GzipMiddleware] Finished processing request")
 	}
 }
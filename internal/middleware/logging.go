@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader заголовок с идентификатором запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничение длины идентификатора, принятого от клиента.
+const maxRequestIDLength = 128
+
+// AccessLog присваивает запросу идентификатор и после обработки пишет одну запись
+// access-лога. Идентификатор берется из заголовка X-Request-ID, если клиент передал
+// корректное значение, иначе генерируется, и возвращается в том же заголовке ответа.
+// Записи лога, сделанные через logger.FromContext во время запроса, получают его в поле request_id.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+			zap.Int("size", max(c.Writer.Size(), 0)),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_id", UserID(c)),
+		}
+
+		log := logger.FromContext(c.Request.Context())
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			log.Error("HTTP request", fields...)
+			return
+		}
+		log.Info("HTTP request", fields...)
+	}
+}
+
+// Recovery перехватывает панику обработчика, логирует ее и отвечает 500.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// Обрыв соединения http.Server обрабатывает сам
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			logger.FromContext(c.Request.Context()).Error("Panic while handling request",
+				zap.Any("panic", recovered), zap.Stack("stack"))
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+// validRequestID принимает непустые идентификаторы разумной длины из видимых ASCII символов,
+// чтобы значение из заголовка нельзя было использовать для подделки записей лога.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read не возвращает ошибку начиная с Go 1.24
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
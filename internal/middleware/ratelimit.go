@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimit отклоняет запросы сверх лимита limiter с кодом 429 и заголовком Retry-After.
+// Каждый запрос расходует лимит IP клиента, а запрос с валидной cookie — еще и лимит
+// пользователя: cookie выдается бесплатно, поэтому только по ней считать нельзя.
+// Middleware подключается после Auth. При nil limiter запросы не ограничиваются.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	if limiter == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		keys := []string{"ip:" + c.ClientIP()}
+		if IsAuthenticated(c) {
+			keys = append(keys, "user:"+UserID(c))
+		}
+
+		for _, key := range keys {
+			allowed, retryAfter := limiter.Allow(key)
+			if allowed {
+				continue
+			}
+			logger.FromContext(c.Request.Context()).Debug("Rate limit exceeded", zap.String("key", key))
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.String(http.StatusTooManyRequests, "Too many requests!")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
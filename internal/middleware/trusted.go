@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TrustedSubnet пропускает только запросы, у которых IP из заголовка X-Real-IP
+// входит в подсеть cidr. Если подсеть не задана, доступ запрещен всем.
+func TrustedSubnet(cidr string) gin.HandlerFunc {
+	var subnet netip.Prefix
+	if cidr != "" {
+		var err error
+		subnet, err = netip.ParsePrefix(cidr)
+		if err != nil {
+			logger.Log.Error("Invalid trusted subnet, access denied for all", zap.String("cidr", cidr), zap.Error(err))
+		}
+	}
+
+	return func(c *gin.Context) {
+		if !subnet.IsValid() {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		ip, err := netip.ParseAddr(c.GetHeader("X-Real-IP"))
+		if err != nil || !subnet.Contains(ip.Unmap()) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
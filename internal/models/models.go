@@ -1,7 +1,12 @@
 package models
 
+import "time"
+
 type Request struct {
-	URL string `json:"url"`
+	URL        string     `json:"url"`
+	Alias      string     `json:"alias,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty"`
 }
 
 type Response struct {
@@ -9,11 +14,61 @@ type Response struct {
 }
 
 type BatchRequestItem struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
 }
 
+// Статусы элемента ответа пакетного сокращения.
+const (
+	// BatchStatusCreated создана новая короткая ссылка.
+	BatchStatusCreated = "created"
+	// BatchStatusConflict URL уже был сокращен, возвращена существующая ссылка.
+	BatchStatusConflict = "conflict"
+)
+
 type BatchResponseItem struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
+	Status        string `json:"status"`
+}
+
+type UserURLItem struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+}
+
+// PingStatus подробный ответ /ping: состояние сервиса, активное хранилище и доступность БД.
+type PingStatus struct {
+	Status   string `json:"status"`
+	Storage  string `json:"storage"`
+	Database string `json:"database"`
+}
+
+// InternalStats агрегированная статистика сервиса для внутреннего эндпоинта.
+type InternalStats struct {
+	URLs  int         `json:"urls"`
+	Users int         `json:"users"`
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// CacheStats счетчики кэша чтения ссылок. Присутствует в статистике, только если кэш включен.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+type URLStats struct {
+	ShortURL       string        `json:"short_url"`
+	TotalClicks    int64         `json:"total_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	Daily          []DailyClicks `json:"daily"`
 }
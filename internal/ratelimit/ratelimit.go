@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/config"
+)
+
+// Limiter ограничивает частоту запросов по ключу алгоритмом token bucket.
+// Корзины хранятся в памяти и удаляются, если ключ не обращался дольше idleTTL.
+// При idleTTL не меньше времени полного пополнения корзины удаление не меняет
+// поведение: вернувшийся клиент получил бы полную корзину в любом случае.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limits ограничители групп операций. Один набор используется HTTP и gRPC API,
+// чтобы клиент не обходил лимит сменой протокола. Nil означает, что лимит выключен.
+type Limits struct {
+	Create   *Limiter
+	Batch    *Limiter
+	Redirect *Limiter
+}
+
+// NewLimits создает ограничители по настройкам приложения. Группа с нулевым
+// числом запросов в минуту не ограничивается.
+func NewLimits(appConfig config.Config) *Limits {
+	newLimiter := func(perMinute, burst int) *Limiter {
+		if perMinute <= 0 {
+			return nil
+		}
+		return New(perMinute, burst, appConfig.RateLimitIdleTTL)
+	}
+	return &Limits{
+		Create:   newLimiter(appConfig.RateLimitCreate, appConfig.RateLimitCreateBurst),
+		Batch:    newLimiter(appConfig.RateLimitBatch, appConfig.RateLimitBatchBurst),
+		Redirect: newLimiter(appConfig.RateLimitRedirect, appConfig.RateLimitRedirectBurst),
+	}
+}
+
+// New создает ограничитель на perMinute запросов в минуту с запасом burst запросов подряд.
+func New(perMinute, burst int, idleTTL time.Duration) *Limiter {
+	return &Limiter{
+		rate:      float64(perMinute) / 60,
+		burst:     float64(burst),
+		idleTTL:   idleTTL,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow списывает токен с корзины key. Если токенов нет, возвращает false
+// и время, через которое появится следующий токен.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Len возвращает количество отслеживаемых ключей.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep удаляет корзины, простаивающие дольше idleTTL. Проход выполняется
+// не чаще раза в idleTTL, поэтому его стоимость распределяется по запросам.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -3,28 +3,53 @@ package router
 import (
 	"net/http"
 
+	"github.com/MaxRadzey/shortener/internal/auth"
+	"github.com/MaxRadzey/shortener/internal/config"
 	"github.com/MaxRadzey/shortener/internal/handler"
 	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/metrics"
 	"github.com/MaxRadzey/shortener/internal/middleware"
+	"github.com/MaxRadzey/shortener/internal/ratelimit"
+	"github.com/MaxRadzey/shortener/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // SetupRouter создает и настраивает HTTP роутер со всеми middleware и маршрутами.
-func SetupRouter(h *handler.Handler) *gin.Engine {
-	r := gin.Default()
+// limits расходуются совместно с gRPC API.
+func SetupRouter(h *handler.Handler, appConfig *config.Config, limits *ratelimit.Limits) *gin.Engine {
+	r := gin.New()
 	r.HandleMethodNotAllowed = true
+	// По умолчанию gin доверяет X-Forwarded-For от любого клиента, и IP для лимитов можно подделать.
+	// Список проверен при загрузке конфигурации
+	if err := r.SetTrustedProxies(appConfig.TrustedProxies); err != nil {
+		logger.Log.Error("Failed to set trusted proxies", zap.Error(err))
+	}
 
 	SetupMiddleware(r)
 
-	r.Use(logger.RequestLogger())
-	r.Use(logger.ResponseLogger())
+	r.Use(tracing.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.Recovery())
 	r.Use(middleware.Gzip())
+	r.Use(middleware.Auth(auth.NewSigner(appConfig.SecretKey), appConfig.EnableHTTPS))
 
-	r.POST("/", h.CreateURL)
-	r.GET("/:short_path", h.GetURL)
-	r.POST("/api/shorten", h.GetURLJSON)
-	r.POST("/api/shorten/batch", h.CreateURLBatch)
+	// Оба способа создать ссылку расходуют общий лимит клиента
+	createLimit := middleware.RateLimit(limits.Create)
+	batchLimit := middleware.RateLimit(limits.Batch)
+	redirectLimit := middleware.RateLimit(limits.Redirect)
+
+	r.POST("/", createLimit, h.CreateURL)
+	r.GET("/:short_path", redirectLimit, h.GetURL)
+	r.POST("/api/shorten", createLimit, h.GetURLJSON)
+	r.POST("/api/shorten/batch", batchLimit, h.CreateURLBatch)
 	r.GET("/ping", h.Ping)
+	r.GET("/api/user/urls", h.GetUserURLs)
+	r.DELETE("/api/user/urls", h.DeleteUserURLs)
+	r.GET("/api/urls/:id/stats", h.GetURLStats)
+	r.GET("/api/internal/stats", middleware.TrustedSubnet(appConfig.TrustedSubnet), h.GetInternalStats)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	return r
 }
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/internal/models"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"github.com/MaxRadzey/shortener/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// clickQueueSize размер буфера событий переходов. При переполнении события отбрасываются.
+	clickQueueSize = 4096
+	// clickBatchSize количество событий, после которого пачка сбрасывается в хранилище.
+	clickBatchSize = 256
+	// clickFlushInterval максимальное время ожидания перед сбросом неполной пачки.
+	clickFlushInterval = time.Second
+)
+
+// ClickInfo сведения о переходе, полученные из HTTP запроса.
+type ClickInfo struct {
+	Referrer  string
+	UserAgent string
+	IP        string
+}
+
+// clickRecorder буферизует события переходов и пачками сохраняет их в хранилище.
+// Запись события никогда не блокирует обработку редиректа.
+type clickRecorder struct {
+	storage dbstorage.ClickStorage
+	events  chan dbstorage.ClickEvent
+	dropped atomic.Int64
+}
+
+func newClickRecorder(storage dbstorage.ClickStorage) *clickRecorder {
+	return &clickRecorder{
+		storage: storage,
+		events:  make(chan dbstorage.ClickEvent, clickQueueSize),
+	}
+}
+
+// record ставит событие в очередь или отбрасывает его, если очередь заполнена.
+func (r *clickRecorder) record(event dbstorage.ClickEvent) {
+	select {
+	case r.events <- event:
+	default:
+		if dropped := r.dropped.Add(1); dropped%clickQueueSize == 1 {
+			logger.Log.Warn("Click queue is full, dropping events", zap.Int64("dropped", dropped))
+		}
+	}
+}
+
+// run сохраняет события до отмены контекста, после чего сбрасывает оставшиеся в очереди.
+func (r *clickRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]dbstorage.ClickEvent, 0, clickBatchSize)
+
+	for {
+		select {
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) >= clickBatchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-r.events:
+					batch = append(batch, event)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *clickRecorder) flush(batch []dbstorage.ClickEvent) []dbstorage.ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := r.storage.SaveClicks(context.Background(), batch); err != nil {
+		logger.Log.Error("Failed to save clicks", zap.Int("count", len(batch)), zap.Error(err))
+	}
+
+	return batch[:0]
+}
+
+// RecordClick регистрирует переход по короткой ссылке. IP-адрес сохраняется только в виде хэша.
+func (s *Service) RecordClick(shortPath string, info ClickInfo) {
+	s.clicks.record(dbstorage.ClickEvent{
+		ShortPath: shortPath,
+		Timestamp: time.Now().UTC(),
+		Referrer:  info.Referrer,
+		UserAgent: info.UserAgent,
+		IPHash:    s.hashIP(info.IP),
+	})
+}
+
+// hashIP возвращает HMAC от IP-адреса, чтобы считать уникальных посетителей без хранения адресов.
+func (s *Service) hashIP(ip string) string {
+	h := hmac.New(sha256.New, []byte(s.appConfig.SecretKey))
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// GetURLStats возвращает статистику переходов по ссылке.
+// Возвращает ErrURLNotFound, если ссылка никогда не создавалась.
+// Для удаленных и истекших ссылок статистика по-прежнему доступна.
+func (s *Service) GetURLStats(ctx context.Context, shortPath string) (models.URLStats, error) {
+	ctx, span := tracing.Start(ctx, "service.GetURLStats")
+	defer span.End()
+
+	_, err := s.GetLongURL(ctx, shortPath)
+	if err != nil && !errors.Is(err, ErrURLDeleted) && !errors.Is(err, ErrURLExpired) {
+		return models.URLStats{}, err
+	}
+
+	stats, err := s.clickStorage.GetClickStats(ctx, shortPath)
+	if err != nil {
+		return models.URLStats{}, fmt.Errorf("failed to get click stats: %w", err)
+	}
+
+	daily := make([]models.DailyClicks, 0, len(stats.Daily))
+	for _, day := range stats.Daily {
+		daily = append(daily, models.DailyClicks{
+			Date:   day.Date.Format(time.DateOnly),
+			Clicks: day.Clicks,
+		})
+	}
+
+	return models.URLStats{
+		ShortURL:       s.shortURL(shortPath),
+		TotalClicks:    stats.TotalClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+		Daily:          daily,
+	}, nil
+}
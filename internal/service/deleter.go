@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// deleteQueueSize размер буфера входящих запросов на удаление.
+	deleteQueueSize = 1024
+	// deleteBatchSize количество ссылок, после которого пачка сбрасывается в хранилище.
+	deleteBatchSize = 500
+	// deleteFlushInterval максимальное время ожидания перед сбросом неполной пачки.
+	deleteFlushInterval = 500 * time.Millisecond
+)
+
+// deleteTask запрос пользователя на удаление набора ссылок.
+type deleteTask struct {
+	userID     string
+	shortPaths []string
+}
+
+// deleteWorker собирает запросы на удаление от всех обработчиков в один канал (fan-in)
+// и передает их в хранилище пачками.
+type deleteWorker struct {
+	storage dbstorage.URLStorage
+	tasks   chan deleteTask
+	done    chan struct{}
+	once    sync.Once
+	// mu отделяет отправку в очередь от остановки: enqueue держит RLock на время отправки,
+	// а run выставляет closed под Lock, дожидаясь всех начатых отправок.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newDeleteWorker(storage dbstorage.URLStorage) *deleteWorker {
+	return &deleteWorker{
+		storage: storage,
+		tasks:   make(chan deleteTask, deleteQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue ставит задачу в очередь. Возвращает ErrShuttingDown, если воркер уже остановлен,
+// и ошибку контекста, если ctx отменен раньше, чем в очереди освободилось место.
+func (w *deleteWorker) enqueue(ctx context.Context, task deleteTask) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrShuttingDown
+	}
+
+	select {
+	case w.tasks <- task:
+		return nil
+	case <-w.done:
+		return ErrShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run обрабатывает очередь до отмены контекста, после чего сбрасывает накопленные задачи.
+func (w *deleteWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]dbstorage.DeleteItem, 0, deleteBatchSize)
+
+	for {
+		select {
+		case task := <-w.tasks:
+			batch = appendTask(batch, task)
+			if len(batch) >= deleteBatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-ctx.Done():
+			// Закрытие done прерывает отправки, ждущие места в очереди. После closed новых
+			// отправок не будет, и все принятые задачи уже лежат в канале
+			w.once.Do(func() { close(w.done) })
+			w.mu.Lock()
+			w.closed = true
+			w.mu.Unlock()
+			// Забираем задачи, успевшие попасть в очередь до остановки
+			for {
+				select {
+				case task := <-w.tasks:
+					batch = appendTask(batch, task)
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func appendTask(batch []dbstorage.DeleteItem, task deleteTask) []dbstorage.DeleteItem {
+	for _, shortPath := range task.shortPaths {
+		batch = append(batch, dbstorage.DeleteItem{UserID: task.userID, ShortPath: shortPath})
+	}
+	return batch
+}
+
+// flush передает пачку в хранилище и возвращает пустой срез для переиспользования.
+func (w *deleteWorker) flush(batch []dbstorage.DeleteItem) []dbstorage.DeleteItem {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// Хранилище должно успеть обработать пачку даже во время остановки сервиса
+	if err := w.storage.DeleteURLs(context.Background(), batch); err != nil {
+		logger.Log.Error("Failed to delete URLs", zap.Int("count", len(batch)), zap.Error(err))
+	} else {
+		logger.Log.Debug("URLs deleted", zap.Int("count", len(batch)))
+	}
+
+	return batch[:0]
+}
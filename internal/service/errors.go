@@ -1,13 +1,21 @@
 package service
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ErrValidation представляет ошибку валидации URL
 type ErrValidation struct {
 	URL string
+	// Reason уточняет причину ошибки, если она известна.
+	Reason string
 }
 
 func (e *ErrValidation) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("validation error: %s", e.Reason)
+	}
 	return fmt.Sprintf("validation error: invalid URL %q", e.URL)
 }
 
@@ -19,3 +27,27 @@ type ErrURLConflict struct {
 func (e *ErrURLConflict) Error() string {
 	return fmt.Sprintf("url already exists: %s", e.ShortURL)
 }
+
+// ErrAliasConflict представляет ошибку, когда запрошенный алиас уже занят другим URL
+type ErrAliasConflict struct {
+	Alias string
+}
+
+func (e *ErrAliasConflict) Error() string {
+	return fmt.Sprintf("alias %q is already taken", e.Alias)
+}
+
+// ErrURLNotFound возвращается, если короткая ссылка не найдена.
+var ErrURLNotFound = errors.New("url not found")
+
+// ErrURLDeleted возвращается при обращении к удаленной ссылке.
+var ErrURLDeleted = errors.New("url deleted")
+
+// ErrURLExpired возвращается при обращении к ссылке с истекшим сроком действия.
+var ErrURLExpired = errors.New("url expired")
+
+// ErrShuttingDown возвращается, если сервис уже останавливается и не принимает новые задачи.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// ErrShortPathExhausted возвращается, если не удалось подобрать свободный короткий путь.
+var ErrShortPathExhausted = errors.New("failed to generate unique short path")
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/utils"
+)
+
+// Доступные стратегии генерации коротких путей.
+const (
+	GeneratorHash       = "hash"
+	GeneratorRandom     = "random"
+	GeneratorSequential = "sequential"
+)
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// randomPathLength длина случайного короткого пути.
+	randomPathLength = 8
+	// maxHashPathLength максимальная длина пути, получаемого из sha1 в base64.
+	maxHashPathLength = 27
+)
+
+// ShortPathGenerator генерирует короткие пути для URL.
+type ShortPathGenerator interface {
+	// Generate возвращает короткий путь для URL. attempt — номер попытки, начиная с нуля:
+	// при коллизии сервис повторяет генерацию с увеличенным attempt.
+	Generate(longURL string, attempt int) (string, error)
+}
+
+// NewShortPathGenerator создает генератор по его названию из конфигурации.
+func NewShortPathGenerator(kind string) (ShortPathGenerator, error) {
+	switch kind {
+	case "", GeneratorHash:
+		return HashGenerator{}, nil
+	case GeneratorRandom:
+		return RandomGenerator{Length: randomPathLength}, nil
+	case GeneratorSequential:
+		return NewSequentialGenerator(uint64(time.Now().UnixMilli())), nil
+	default:
+		return nil, fmt.Errorf("unknown short path generator %q", kind)
+	}
+}
+
+// HashGenerator строит короткий путь из sha1 хэша URL.
+// Первая попытка совпадает с utils.GetShortPath, последующие добавляют к URL соль
+// и удлиняют результат на символ за каждую попытку.
+type HashGenerator struct{}
+
+func (HashGenerator) Generate(longURL string, attempt int) (string, error) {
+	if attempt == 0 {
+		return utils.GetShortPath(longURL)
+	}
+	if strings.TrimSpace(longURL) == "" {
+		return "", errors.New("empty string cannot be shortened")
+	}
+
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s#%d", longURL, attempt)))
+	encoded := base64.URLEncoding.EncodeToString(hash[:])
+
+	length := min(6+attempt, maxHashPathLength)
+	return encoded[:length], nil
+}
+
+// RandomGenerator возвращает случайный путь из символов base62.
+type RandomGenerator struct {
+	Length int
+}
+
+func (g RandomGenerator) Generate(_ string, _ int) (string, error) {
+	var sb strings.Builder
+	sb.Grow(g.Length)
+
+	limit := big.NewInt(int64(len(base62Alphabet)))
+	for i := 0; i < g.Length; i++ {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("failed to read random: %w", err)
+		}
+		sb.WriteByte(base62Alphabet[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// SequentialGenerator выдает последовательные идентификаторы, закодированные в base62.
+// Счетчик стартует с переданного значения; по умолчанию это текущее время в миллисекундах,
+// чтобы после перезапуска не выдавать уже использованные идентификаторы.
+type SequentialGenerator struct {
+	counter atomic.Uint64
+}
+
+// NewSequentialGenerator создает генератор, первый идентификатор которого равен start.
+func NewSequentialGenerator(start uint64) *SequentialGenerator {
+	g := &SequentialGenerator{}
+	g.counter.Store(start)
+	return g
+}
+
+func (g *SequentialGenerator) Generate(_ string, _ int) (string, error) {
+	return encodeBase62(g.counter.Add(1) - 1), nil
+}
+
+func encodeBase62(n uint64) string {
+	if n == 0 {
+		return base62Alphabet[:1]
+	}
+
+	var buf [11]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+	}
+	return string(buf[i:])
+}
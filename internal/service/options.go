@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/models"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+
+	// maxTTLSeconds максимальное время жизни ссылки (десять лет).
+	maxTTLSeconds = 10 * 365 * 24 * 60 * 60
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases пути, занятые маршрутами сервиса.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"ping":    {},
+	"metrics": {},
+}
+
+// CreateOptions дополнительные параметры создания короткой ссылки.
+type CreateOptions struct {
+	// Alias желаемый короткий путь. Если пуст, путь генерируется автоматически.
+	Alias string
+	// ExpiresAt абсолютный момент истечения срока действия ссылки.
+	ExpiresAt *time.Time
+	// TTLSeconds время жизни ссылки в секундах с момента создания.
+	// Не может задаваться вместе с ExpiresAt.
+	TTLSeconds int64
+}
+
+// itemError дополняет причину ошибки валидации идентификатором элемента пакета,
+// чтобы клиент мог найти некорректный элемент.
+func itemError(item models.BatchRequestItem, err error) error {
+	var validationErr *ErrValidation
+	if errors.As(err, &validationErr) && validationErr.Reason != "" {
+		validationErr.Reason = fmt.Sprintf("item %q: %s", item.CorrelationID, validationErr.Reason)
+	}
+	return err
+}
+
+// itemOptions извлекает параметры создания из элемента пакетного запроса.
+func itemOptions(item models.BatchRequestItem) CreateOptions {
+	return CreateOptions{
+		Alias:      item.Alias,
+		ExpiresAt:  item.ExpiresAt,
+		TTLSeconds: item.TTLSeconds,
+	}
+}
+
+// expiresAt вычисляет момент истечения срока действия ссылки.
+// Возвращает nil для бессрочной ссылки.
+func (o CreateOptions) expiresAt(longURL string, now time.Time) (*time.Time, error) {
+	switch {
+	case o.ExpiresAt != nil && o.TTLSeconds != 0:
+		return nil, &ErrValidation{URL: longURL, Reason: "expires_at and ttl_seconds are mutually exclusive"}
+	case o.TTLSeconds < 0 || o.TTLSeconds > maxTTLSeconds:
+		return nil, &ErrValidation{URL: longURL, Reason: fmt.Sprintf("ttl_seconds must be between 1 and %d", maxTTLSeconds)}
+	case o.TTLSeconds > 0:
+		expiresAt := now.Add(time.Duration(o.TTLSeconds) * time.Second).UTC()
+		return &expiresAt, nil
+	case o.ExpiresAt != nil:
+		if !o.ExpiresAt.After(now) {
+			return nil, &ErrValidation{URL: longURL, Reason: "expires_at must be in the future"}
+		}
+		expiresAt := o.ExpiresAt.UTC()
+		return &expiresAt, nil
+	}
+	return nil, nil
+}
+
+// validateAlias проверяет длину, набор символов и зарезервированные слова алиаса.
+func validateAlias(longURL, alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return &ErrValidation{
+			URL:    longURL,
+			Reason: fmt.Sprintf("alias length must be between %d and %d characters", minAliasLength, maxAliasLength),
+		}
+	}
+	if !aliasPattern.MatchString(alias) {
+		return &ErrValidation{URL: longURL, Reason: "alias may contain only latin letters, digits, '-' and '_'"}
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return &ErrValidation{URL: longURL, Reason: fmt.Sprintf("alias %q is reserved", alias)}
+	}
+	return nil
+}
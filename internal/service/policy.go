@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/MaxRadzey/shortener/internal/config"
+)
+
+// URLPolicy проверяет ссылки назначения перед сокращением: длину, схему, хост,
+// списки разрешенных и запрещенных доменов и ссылки на сам сервис.
+// Доменные имена не резолвятся: проверка адресов применяется только к IP в самой ссылке
+// и к именам localhost, так как результат резолва на момент создания не гарантирует
+// адрес, на который попадет пользователь при переходе.
+type URLPolicy struct {
+	schemes        []string
+	allowedDomains []string
+	deniedDomains  []string
+	allowPrivate   bool
+	maxLength      int
+	// selfHost хост адреса коротких ссылок. Ссылка на него образовала бы цикл редиректов.
+	selfHost string
+}
+
+// NewURLPolicy создает политику из настроек приложения.
+func NewURLPolicy(appConfig config.Config) *URLPolicy {
+	p := &URLPolicy{
+		schemes:        lowerAll(appConfig.URLAllowedSchemes),
+		allowedDomains: lowerAll(appConfig.URLAllowedDomains),
+		deniedDomains:  lowerAll(appConfig.URLDeniedDomains),
+		allowPrivate:   appConfig.URLAllowPrivateHosts,
+		maxLength:      appConfig.URLMaxLength,
+	}
+	if u, err := url.Parse(appConfig.ReturningAddress); err == nil {
+		p.selfHost = normalizeHost(u.Hostname())
+	}
+	return p
+}
+
+// Check возвращает *ErrValidation с причиной отказа, если ссылка не проходит политику.
+func (p *URLPolicy) Check(longURL string) error {
+	reject := func(format string, args ...any) error {
+		return &ErrValidation{URL: longURL, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if strings.TrimSpace(longURL) == "" {
+		return reject("url is empty")
+	}
+	if p.maxLength > 0 && len(longURL) > p.maxLength {
+		return reject("url is longer than %d bytes", p.maxLength)
+	}
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return reject("url cannot be parsed")
+	}
+	if u.Scheme == "" {
+		return reject("url must be absolute, with scheme and host")
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !slices.Contains(p.schemes, scheme) {
+		return reject("scheme %q is not allowed", scheme)
+	}
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return reject("url must include a host")
+	}
+
+	if p.selfHost != "" && host == p.selfHost {
+		return reject("url points to the shortener itself")
+	}
+	if !p.allowPrivate {
+		if reason := privateHostReason(host); reason != "" {
+			return reject("host %q %s", host, reason)
+		}
+	}
+	for _, pattern := range p.deniedDomains {
+		if matchDomain(host, pattern) {
+			return reject("domain %q is denied", host)
+		}
+	}
+	if len(p.allowedDomains) > 0 {
+		for _, pattern := range p.allowedDomains {
+			if matchDomain(host, pattern) {
+				return nil
+			}
+		}
+		return reject("domain %q is not in the allowed list", host)
+	}
+	return nil
+}
+
+// internalPrefixes диапазоны IPv4, не покрытые методами netip.Addr: 0.0.0.0/8 («эта сеть»,
+// адреса из нее Linux направляет на локальный хост) и CGNAT 100.64.0.0/10 провайдеров и облаков.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// privateHostReason возвращает причину отказа для хостов, ведущих во внутреннюю сеть,
+// или пустую строку для публичных.
+func privateHostReason(host string) string {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return "is a loopback address"
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		// Браузеры трактуют имя с числовым последним элементом как IPv4 в сокращенной,
+		// восьмеричной или шестнадцатеричной записи (http://2130706433/ ведет на 127.0.0.1)
+		last := host[strings.LastIndex(host, ".")+1:]
+		if isNumericLabel(last) {
+			return "is not a canonical IP address"
+		}
+		return ""
+	}
+	addr = addr.Unmap()
+	switch {
+	case addr.IsLoopback():
+		return "is a loopback address"
+	case addr.IsPrivate(), addr.IsLinkLocalUnicast(), addr.IsUnspecified(),
+		addr.IsLinkLocalMulticast(), addr.IsInterfaceLocalMulticast():
+		return "is a private address"
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return "is a private address"
+		}
+	}
+	return ""
+}
+
+// matchDomain сравнивает хост с записью списка доменов. Запись *.example.com совпадает
+// с поддоменами example.com, но не с самим example.com.
+func matchDomain(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix)
+	}
+	return host == pattern
+}
+
+// normalizeHost приводит хост к нижнему регистру и убирает завершающую точку FQDN.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func isNumericLabel(label string) bool {
+	if label == "" {
+		return false
+	}
+	if strings.HasPrefix(label, "0x") {
+		return true
+	}
+	for _, r := range label {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
@@ -4,57 +4,159 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/MaxRadzey/shortener/internal/config"
+	"github.com/MaxRadzey/shortener/internal/logger"
 	"github.com/MaxRadzey/shortener/internal/models"
 	dbstorage "github.com/MaxRadzey/shortener/internal/storage"
-	"github.com/MaxRadzey/shortener/internal/utils"
+	"github.com/MaxRadzey/shortener/internal/tracing"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 )
 
+// maxGenerateAttempts количество попыток сгенерировать свободный короткий путь.
+const maxGenerateAttempts = 5
+
 type Service struct {
-	storage   dbstorage.URLStorage
-	appConfig config.Config
-	db        *pgxpool.Pool
+	storage      dbstorage.URLStorage
+	clickStorage dbstorage.ClickStorage
+	appConfig    config.Config
+	db           *pgxpool.Pool
+	generator    ShortPathGenerator
+	policy       *URLPolicy
+	deleter      *deleteWorker
+	clicks       *clickRecorder
+	wg           sync.WaitGroup
 }
 
-func NewService(storage dbstorage.URLStorage, appConfig config.Config, db *pgxpool.Pool) *Service {
+// NewService создает сервис. Если хранилище переходов не передано,
+// статистика хранится в памяти.
+func NewService(storage dbstorage.URLStorage, clickStorage dbstorage.ClickStorage, appConfig config.Config, db *pgxpool.Pool) *Service {
+	generator, err := NewShortPathGenerator(appConfig.ShortPathGenerator)
+	if err != nil {
+		logger.Log.Warn("Falling back to hash short path generator", zap.Error(err))
+		generator = HashGenerator{}
+	}
+
+	if clickStorage == nil {
+		clickStorage = dbstorage.NewMemoryClickStorage(dbstorage.DefaultClickRingSize)
+	}
+
 	return &Service{
-		storage:   storage,
-		appConfig: appConfig,
-		db:        db,
+		storage:      storage,
+		clickStorage: clickStorage,
+		appConfig:    appConfig,
+		db:           db,
+		generator:    generator,
+		policy:       NewURLPolicy(appConfig),
+		deleter:      newDeleteWorker(storage),
+		clicks:       newClickRecorder(clickStorage),
 	}
 }
 
-func (s *Service) CreateShortURL(longURL string) (string, error) {
-	if !utils.IsValidURL(longURL) {
-		return "", &ErrValidation{URL: longURL}
+// Start запускает фоновые воркеры сервиса. Воркеры работают до отмены контекста.
+func (s *Service) Start(ctx context.Context) {
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.deleter.run(ctx)
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.clicks.run(ctx)
+	}()
+
+	if s.appConfig.ExpirySweepInterval > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runExpirySweeper(ctx, s.appConfig.ExpirySweepInterval)
+		}()
 	}
+}
+
+// Wait ожидает завершения фоновых воркеров после отмены контекста,
+// переданного в Start.
+func (s *Service) Wait() {
+	s.wg.Wait()
+}
 
-	shortPath, err := utils.GetShortPath(longURL)
+// CreateShortURL сокращает URL. При коллизии короткого пути генерация повторяется
+// не более maxGenerateAttempts раз. Если указан алиас, он используется как короткий путь,
+// а его занятость другим URL приводит к ErrAliasConflict.
+func (s *Service) CreateShortURL(ctx context.Context, longURL, userID string, opts CreateOptions) (string, error) {
+	ctx, span := tracing.Start(ctx, "service.CreateShortURL")
+	defer span.End()
+
+	if err := s.policy.Check(longURL); err != nil {
+		return "", err
+	}
+	if opts.Alias != "" {
+		if err := validateAlias(longURL, opts.Alias); err != nil {
+			return "", err
+		}
+	}
+	expiresAt, err := opts.expiresAt(longURL, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("failed to generate short path: %w", err)
+		return "", err
 	}
 
-	err = s.storage.Create(shortPath, longURL)
-	if err != nil {
-		// Проверяем, является ли ошибка конфликтом существующего URL
-		var urlExistsErr *dbstorage.ErrURLAlreadyExists
-		if errors.As(err, &urlExistsErr) {
-			// Формируем полный URL для существующего short_path
-			existingURL := fmt.Sprintf("%s/%s", s.appConfig.ReturningAddress, urlExistsErr.ShortPath)
-			return existingURL, &ErrURLConflict{ShortURL: existingURL}
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		shortPath, err := s.nextShortPath(ctx, longURL, opts.Alias, attempt)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate short path: %w", err)
+		}
+
+		err = s.storage.Create(ctx, dbstorage.URLRecord{
+			ShortPath:   shortPath,
+			OriginalURL: longURL,
+			UserID:      userID,
+			ExpiresAt:   expiresAt,
+		})
+		if err != nil {
+			var collisionErr *dbstorage.ErrShortPathCollision
+			if errors.As(err, &collisionErr) {
+				if opts.Alias != "" {
+					return "", &ErrAliasConflict{Alias: opts.Alias}
+				}
+				logger.FromContext(ctx).Debug("Short path collision, retrying",
+					zap.String("short_path", shortPath), zap.Int("attempt", attempt))
+				continue
+			}
+			// Проверяем, является ли ошибка конфликтом существующего URL
+			var urlExistsErr *dbstorage.ErrURLAlreadyExists
+			if errors.As(err, &urlExistsErr) {
+				// Формируем полный URL для существующего short_path
+				existingURL := s.shortURL(urlExistsErr.ShortPath)
+				return existingURL, &ErrURLConflict{ShortURL: existingURL}
+			}
+			return "", fmt.Errorf("failed to save URL: %w", err)
 		}
-		return "", fmt.Errorf("failed to save URL: %w", err)
+
+		return s.shortURL(shortPath), nil
 	}
 
-	result := fmt.Sprintf("%s/%s", s.appConfig.ReturningAddress, shortPath)
-	return result, nil
+	return "", ErrShortPathExhausted
 }
 
-func (s *Service) GetLongURL(shortPath string) (string, error) {
-	longURL, err := s.storage.Get(shortPath)
+func (s *Service) GetLongURL(ctx context.Context, shortPath string) (string, error) {
+	ctx, span := tracing.Start(ctx, "service.GetLongURL")
+	defer span.End()
+
+	longURL, err := s.storage.Get(ctx, shortPath)
 	if err != nil {
+		if errors.Is(err, dbstorage.ErrDeleted) {
+			return "", ErrURLDeleted
+		}
+		if errors.Is(err, dbstorage.ErrExpired) {
+			return "", ErrURLExpired
+		}
+		if errors.Is(err, dbstorage.ErrNotFound) {
+			return "", ErrURLNotFound
+		}
 		return "", err
 	}
 
@@ -70,39 +172,186 @@ func (s *Service) Ping(ctx context.Context) error {
 	return s.db.Ping(ctx)
 }
 
+// PingDetails возвращает состояние сервиса: активное хранилище и доступность БД.
+// Без подключения к БД сервис считается работоспособным, а БД — отключенной.
+func (s *Service) PingDetails(ctx context.Context) models.PingStatus {
+	status := models.PingStatus{
+		Status:   "ok",
+		Storage:  dbstorage.BackendName(s.storage),
+		Database: "disabled",
+	}
+	if s.db == nil {
+		return status
+	}
+
+	if err := s.db.Ping(ctx); err != nil {
+		logger.FromContext(ctx).Error("Failed to ping database", zap.Error(err))
+		status.Status = "unavailable"
+		status.Database = "unavailable"
+		return status
+	}
+	status.Database = "ok"
+	return status
+}
+
 // CreateShortURLBatch создает короткие URL для множества URL в одном запросе.
 // Валидирует все URL перед обработкой, генерирует короткие пути и сохраняет их атомарно.
-func (s *Service) CreateShortURLBatch(ctx context.Context, items []models.BatchRequestItem) ([]models.BatchResponseItem, error) {
-	batchItems := make([]dbstorage.BatchItem, 0, len(items))
-	responseItems := make([]models.BatchResponseItem, 0, len(items))
+// При коллизии заново генерируются пути только для конфликтующих записей, всего
+// не более maxGenerateAttempts попыток сохранения, как в CreateShortURL.
+func (s *Service) CreateShortURLBatch(ctx context.Context, items []models.BatchRequestItem, userID string) ([]models.BatchResponseItem, error) {
+	ctx, span := tracing.Start(ctx, "service.CreateShortURLBatch", attribute.Int("batch.size", len(items)))
+	defer span.End()
+
+	records := make([]dbstorage.URLRecord, 0, len(items))
+	now := time.Now()
 
 	for _, item := range items {
-		if !utils.IsValidURL(item.OriginalURL) {
-			return nil, &ErrValidation{URL: item.OriginalURL}
+		if err := s.policy.Check(item.OriginalURL); err != nil {
+			return nil, itemError(item, err)
+		}
+		if item.Alias != "" {
+			if err := validateAlias(item.OriginalURL, item.Alias); err != nil {
+				return nil, itemError(item, err)
+			}
+		}
+		expiresAt, err := itemOptions(item).expiresAt(item.OriginalURL, now)
+		if err != nil {
+			return nil, itemError(item, err)
 		}
 
-		shortPath, err := utils.GetShortPath(item.OriginalURL)
+		shortPath, err := s.nextShortPath(ctx, item.OriginalURL, item.Alias, 0)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate short path: %w", err)
 		}
 
-		batchItems = append(batchItems, dbstorage.BatchItem{
-			ShortPath: shortPath,
-			FullURL:   item.OriginalURL,
+		records = append(records, dbstorage.URLRecord{
+			ShortPath:   shortPath,
+			OriginalURL: item.OriginalURL,
+			UserID:      userID,
+			ExpiresAt:   expiresAt,
 		})
+	}
 
-		shortURL := fmt.Sprintf("%s/%s", s.appConfig.ReturningAddress, shortPath)
+	// Сохраняем все записи атомарно
+	var results []dbstorage.BatchItemResult
+	for attempt := 1; ; attempt++ {
+		if attempt > maxGenerateAttempts {
+			return nil, ErrShortPathExhausted
+		}
+		var err error
+		results, err = s.storage.CreateBatch(ctx, records)
+		if err == nil {
+			break
+		}
+
+		var collisionErr *dbstorage.ErrShortPathCollision
+		if !errors.As(err, &collisionErr) {
+			return nil, fmt.Errorf("failed to save batch URLs: %w", err)
+		}
+
+		for i := range records {
+			if records[i].ShortPath != collisionErr.ShortPath {
+				continue
+			}
+			if items[i].Alias != "" {
+				return nil, &ErrAliasConflict{Alias: items[i].Alias}
+			}
+			logger.FromContext(ctx).Debug("Short path collision in batch, retrying",
+				zap.String("short_path", records[i].ShortPath), zap.Int("attempt", attempt))
+			shortPath, err := s.generate(ctx, records[i].OriginalURL, attempt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate short path: %w", err)
+			}
+			records[i].ShortPath = shortPath
+		}
+	}
+
+	responseItems := make([]models.BatchResponseItem, 0, len(items))
+	for i, item := range items {
+		status := models.BatchStatusCreated
+		if results[i].Existed {
+			status = models.BatchStatusConflict
+		}
 		responseItems = append(responseItems, models.BatchResponseItem{
 			CorrelationID: item.CorrelationID,
-			ShortURL:      shortURL,
+			ShortURL:      s.shortURL(results[i].ShortPath),
+			Status:        status,
 		})
 	}
 
-	// Сохраняем все записи атомарно
-	err := s.storage.CreateBatch(ctx, batchItems)
+	return responseItems, nil
+}
+
+// GetUserURLs возвращает все короткие ссылки, созданные пользователем.
+func (s *Service) GetUserURLs(ctx context.Context, userID string) ([]models.UserURLItem, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUserURLs")
+	defer span.End()
+
+	records, err := s.storage.GetUserURLs(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save batch URLs: %w", err)
+		return nil, fmt.Errorf("failed to get user URLs: %w", err)
 	}
 
-	return responseItems, nil
+	items := make([]models.UserURLItem, 0, len(records))
+	for _, record := range records {
+		items = append(items, models.UserURLItem{
+			ShortURL:    s.shortURL(record.ShortPath),
+			OriginalURL: record.OriginalURL,
+		})
+	}
+
+	return items, nil
+}
+
+// GetInternalStats возвращает количество сокращенных ссылок и пользователей сервиса,
+// а при включенном кэше чтения — его счетчики.
+func (s *Service) GetInternalStats(ctx context.Context) (models.InternalStats, error) {
+	ctx, span := tracing.Start(ctx, "service.GetInternalStats")
+	defer span.End()
+
+	urls, err := s.storage.CountURLs(ctx)
+	if err != nil {
+		return models.InternalStats{}, fmt.Errorf("failed to count URLs: %w", err)
+	}
+	users, err := s.storage.CountUsers(ctx)
+	if err != nil {
+		return models.InternalStats{}, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	stats := models.InternalStats{URLs: urls, Users: users}
+	if cached, ok := s.storage.(*dbstorage.CachedStorage); ok {
+		cache := cached.Stats()
+		stats.Cache = &models.CacheStats{Hits: cache.Hits, Misses: cache.Misses, Size: cache.Size}
+	}
+	return stats, nil
+}
+
+// DeleteUserURLs ставит ссылки пользователя в очередь на асинхронное удаление.
+// Если очередь заполнена, ожидание прерывается отменой ctx.
+func (s *Service) DeleteUserURLs(ctx context.Context, userID string, shortPaths []string) error {
+	if len(shortPaths) == 0 {
+		return nil
+	}
+	return s.deleter.enqueue(ctx, deleteTask{userID: userID, shortPaths: shortPaths})
+}
+
+// nextShortPath возвращает алиас, если он задан, иначе генерирует путь для попытки attempt.
+func (s *Service) nextShortPath(ctx context.Context, longURL, alias string, attempt int) (string, error) {
+	if alias != "" {
+		return alias, nil
+	}
+	return s.generate(ctx, longURL, attempt)
+}
+
+// generate генерирует короткий путь в отдельном спане, чтобы время генерации
+// было видно в трассе отдельно от обращения к хранилищу.
+func (s *Service) generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	_, span := tracing.Start(ctx, "service.generateShortPath", attribute.Int("attempt", attempt))
+	defer span.End()
+	return s.generator.Generate(longURL, attempt)
+}
+
+// shortURL формирует полный короткий URL по короткому пути.
+func (s *Service) shortURL(shortPath string) string {
+	return fmt.Sprintf("%s/%s", s.appConfig.ReturningAddress, shortPath)
 }
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// runExpirySweeper периодически помечает удаленными ссылки с истекшим сроком действия.
+func (s *Service) runExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			count, err := s.storage.DeleteExpired(ctx, now)
+			if err != nil {
+				logger.Log.Error("Failed to purge expired URLs", zap.Error(err))
+				continue
+			}
+			if count > 0 {
+				logger.Log.Info("Expired URLs purged", zap.Int64("count", count))
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Бакеты встроенного хранилища.
+var (
+	// boltURLsBucket short_path → kvRecord в JSON.
+	boltURLsBucket = []byte("urls")
+	// boltOriginsBucket уникальный индекс original_url → short_path активных ссылок.
+	boltOriginsBucket = []byte("origins")
+	// boltUsersBucket индекс user_id + "\x00" + short_path для выборки ссылок пользователя.
+	boltUsersBucket = []byte("users")
+	// boltExpiryBucket индекс срок действия (unix nano, big endian) + short_path для очистки истекших ссылок.
+	boltExpiryBucket = []byte("expiry")
+)
+
+// embeddedExtensions расширения файла данных, при которых режим auto выбирает встроенное хранилище.
+var embeddedExtensions = []string{".db", ".bolt"}
+
+// IsEmbeddedPath сообщает, что путь к файлу данных указывает на встроенную базу bbolt.
+func IsEmbeddedPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range embeddedExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// BoltStorage встроенное хранилище ссылок на bbolt. Каждая операция выполняется
+// в отдельной транзакции, уникальность original_url и short_path соблюдается так же,
+// как в PostgresStorage.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage открывает или создает базу по пути path. Файл блокируется
+// на время работы, второй процесс получит ошибку по истечении connectTimeout.
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: connectTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded storage: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltURLsBucket, boltOriginsBucket, boltUsersBucket, boltExpiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+func (b *BoltStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := b.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
+
+func (b *BoltStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
+	var record URLRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getBoltRecord(tx, short)
+		return err
+	})
+	if err != nil {
+		return URLRecord{}, err
+	}
+	if record.IsDeleted {
+		return URLRecord{}, ErrDeleted
+	}
+	if record.Expired(time.Now()) {
+		return URLRecord{}, ErrExpired
+	}
+	return record, nil
+}
+
+func (b *BoltStorage) Create(ctx context.Context, record URLRecord) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		existing, err := activeBoltOrigin(tx, record.OriginalURL, time.Now())
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			return &ErrURLAlreadyExists{ShortPath: existing}
+		}
+		if tx.Bucket(boltURLsBucket).Get([]byte(record.ShortPath)) != nil {
+			return &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+		return putBoltRecord(tx, record)
+	})
+}
+
+// CreateBatch сохраняет пачку в одной транзакции. Уже сокращенные URL получают
+// существующий короткий путь, занятый short_path откатывает всю пачку.
+func (b *BoltStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	results := make([]BatchItemResult, len(records))
+	now := time.Now()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+		for i, record := range records {
+			// Записи пачки попадают в индекс сразу, поэтому повтор URL внутри пачки тоже находится здесь
+			existing, err := activeBoltOrigin(tx, record.OriginalURL, now)
+			if err != nil {
+				return err
+			}
+			if existing != "" {
+				results[i] = BatchItemResult{ShortPath: existing, Existed: true}
+				continue
+			}
+			if urls.Get([]byte(record.ShortPath)) != nil {
+				return &ErrShortPathCollision{ShortPath: record.ShortPath}
+			}
+			if err := putBoltRecord(tx, record); err != nil {
+				return err
+			}
+			results[i] = BatchItemResult{ShortPath: record.ShortPath}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (b *BoltStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	if userID == "" {
+		return nil, nil
+	}
+
+	data := make(map[string]URLRecord)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		prefix := boltUserKey(userID, "")
+		c := tx.Bucket(boltUsersBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			short := string(k[len(prefix):])
+			record, err := getBoltRecord(tx, short)
+			if err != nil {
+				return err
+			}
+			data[short] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user URLs: %w", err)
+	}
+	return collectUserURLs(data, userID), nil
+}
+
+func (b *BoltStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		data := make(map[string]URLRecord, len(items))
+		for _, item := range items {
+			record, err := getBoltRecord(tx, item.ShortPath)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			data[item.ShortPath] = record
+		}
+		return saveBoltDeleted(tx, deletedRecords(data, items))
+	})
+}
+
+// DeleteExpired проходит индекс сроков действия до момента now и помечает ссылки удаленными.
+func (b *BoltStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var changed []URLRecord
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		data := make(map[string]URLRecord)
+		c := tx.Bucket(boltExpiryBucket).Cursor()
+		for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) <= now.UnixNano(); k, _ = c.Next() {
+			short := string(k[8:])
+			record, err := getBoltRecord(tx, short)
+			if err != nil {
+				return err
+			}
+			data[short] = record
+		}
+		changed = expiredRecords(data, now)
+		return saveBoltDeleted(tx, changed)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired URLs: %w", err)
+	}
+	return int64(len(changed)), nil
+}
+
+func (b *BoltStorage) CountURLs(ctx context.Context) (int, error) {
+	count := 0
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltURLsBucket).ForEach(func(k, v []byte) error {
+			record, err := decodeKVRecord(string(k), v)
+			if err != nil {
+				return err
+			}
+			if !record.IsDeleted {
+				count++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count URLs: %w", err)
+	}
+	return count, nil
+}
+
+// CountUsers считает уникальных пользователей с неудаленными ссылками по индексу,
+// ключи которого упорядочены по user_id. После первой активной ссылки остальные ссылки
+// пользователя не проверяются.
+func (b *BoltStorage) CountUsers(ctx context.Context) (int, error) {
+	count := 0
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var last []byte
+		counted := false
+		return tx.Bucket(boltUsersBucket).ForEach(func(k, _ []byte) error {
+			userID, short, _ := bytes.Cut(k, []byte{0})
+			if !bytes.Equal(userID, last) {
+				last = append(last[:0], userID...)
+				counted = false
+			}
+			if counted {
+				return nil
+			}
+			record, err := getBoltRecord(tx, string(short))
+			if err != nil {
+				return err
+			}
+			if !record.IsDeleted {
+				count++
+				counted = true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// Close закрывает базу и снимает блокировку файла.
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+func getBoltRecord(tx *bolt.Tx, short string) (URLRecord, error) {
+	raw := tx.Bucket(boltURLsBucket).Get([]byte(short))
+	if raw == nil {
+		return URLRecord{}, ErrNotFound
+	}
+	return decodeKVRecord(short, raw)
+}
+
+// putBoltRecord сохраняет новую ссылку вместе с индексами.
+func putBoltRecord(tx *bolt.Tx, record URLRecord) error {
+	value, err := json.Marshal(toKVRecord(record))
+	if err != nil {
+		return fmt.Errorf("failed to encode URL: %w", err)
+	}
+	if err := tx.Bucket(boltURLsBucket).Put([]byte(record.ShortPath), value); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltOriginsBucket).Put([]byte(record.OriginalURL), []byte(record.ShortPath)); err != nil {
+		return err
+	}
+	if record.UserID != "" {
+		if err := tx.Bucket(boltUsersBucket).Put(boltUserKey(record.UserID, record.ShortPath), nil); err != nil {
+			return err
+		}
+	}
+	if record.ExpiresAt != nil {
+		if err := tx.Bucket(boltExpiryBucket).Put(boltExpiryKey(*record.ExpiresAt, record.ShortPath), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeBoltOrigin возвращает короткий путь активной ссылки на originalURL или пустую строку.
+// Запись индекса, указывающая на удаленную или истекшую ссылку, будет перезаписана новой ссылкой.
+func activeBoltOrigin(tx *bolt.Tx, originalURL string, now time.Time) (string, error) {
+	short := tx.Bucket(boltOriginsBucket).Get([]byte(originalURL))
+	if short == nil {
+		return "", nil
+	}
+	record, err := getBoltRecord(tx, string(short))
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !record.Active(now) {
+		return "", nil
+	}
+	return record.ShortPath, nil
+}
+
+// saveBoltDeleted сохраняет помеченные удаленными записи и убирает их из индексов
+// сроков и original_url, чтобы URL можно было сократить заново.
+func saveBoltDeleted(tx *bolt.Tx, records []URLRecord) error {
+	origins := tx.Bucket(boltOriginsBucket)
+	for _, record := range records {
+		if bytes.Equal(origins.Get([]byte(record.OriginalURL)), []byte(record.ShortPath)) {
+			if err := origins.Delete([]byte(record.OriginalURL)); err != nil {
+				return err
+			}
+		}
+		value, err := json.Marshal(toKVRecord(record))
+		if err != nil {
+			return fmt.Errorf("failed to encode URL: %w", err)
+		}
+		if err := tx.Bucket(boltURLsBucket).Put([]byte(record.ShortPath), value); err != nil {
+			return err
+		}
+		if record.ExpiresAt != nil {
+			if err := tx.Bucket(boltExpiryBucket).Delete(boltExpiryKey(*record.ExpiresAt, record.ShortPath)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func boltUserKey(userID, short string) []byte {
+	return []byte(userID + "\x00" + short)
+}
+
+func boltExpiryKey(expiresAt time.Time, short string) []byte {
+	key := make([]byte, 8, 8+len(short))
+	binary.BigEndian.PutUint64(key, uint64(expiresAt.UnixNano()))
+	return append(key, short...)
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions параметры кэша чтения ссылок.
+type CacheOptions struct {
+	// Size максимальное количество записей в кэше. Нулевое значение отключает кэш.
+	Size int
+	// TTL время жизни найденной ссылки в кэше, 0 — без ограничения.
+	TTL time.Duration
+	// NegativeTTL время жизни отрицательного ответа (ссылка не найдена, удалена или истекла).
+	// Нулевое значение отключает кэширование промахов.
+	NegativeTTL time.Duration
+}
+
+// CacheStats счетчики обращений к кэшу.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// cacheEntry значение в кэше: запись ссылки либо ошибка хранилища для отрицательного ответа.
+type cacheEntry struct {
+	short     string
+	record    URLRecord
+	err       error
+	expiresAt time.Time
+}
+
+// CachedStorage оборачивает любое хранилище ссылок LRU-кэшем для Get.
+// Записи, создание и удаление передаются в исходное хранилище и сбрасывают
+// затронутые ключи. Запись ссылки со сроком действия хранится в кэше не дольше
+// этого срока, после него Get обращается к хранилищу и получает ErrExpired.
+type CachedStorage struct {
+	backend URLStorage
+	opts    CacheOptions
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	// gen увеличивается при каждой инвалидации. Ответ хранилища, прочитанный до нее,
+	// в кэш не попадает, чтобы не вернуть туда удаленную ссылку.
+	gen uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewCachedStorage(backend URLStorage, opts CacheOptions) *CachedStorage {
+	return &CachedStorage{
+		backend: backend,
+		opts:    opts,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, opts.Size),
+	}
+}
+
+// Backend возвращает исходное хранилище.
+func (c *CachedStorage) Backend() URLStorage {
+	return c.backend
+}
+
+// Stats возвращает текущие значения счетчиков кэша.
+func (c *CachedStorage) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+func (c *CachedStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := c.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
+
+func (c *CachedStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
+	entry, gen := c.lookup(short)
+	if entry != nil {
+		c.hits.Add(1)
+		return entry.record, entry.err
+	}
+	c.misses.Add(1)
+
+	record, err := c.backend.GetRecord(ctx, short)
+	switch {
+	case err == nil:
+		c.store(gen, short, record, nil, c.opts.TTL)
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrDeleted), errors.Is(err, ErrExpired):
+		if c.opts.NegativeTTL > 0 {
+			c.store(gen, short, URLRecord{}, err, c.opts.NegativeTTL)
+		}
+	}
+	return record, err
+}
+
+func (c *CachedStorage) Create(ctx context.Context, record URLRecord) error {
+	defer c.invalidate(record.ShortPath)
+	return c.backend.Create(ctx, record)
+}
+
+func (c *CachedStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	defer func() {
+		for _, record := range records {
+			c.invalidate(record.ShortPath)
+		}
+	}()
+	return c.backend.CreateBatch(ctx, records)
+}
+
+func (c *CachedStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	return c.backend.GetUserURLs(ctx, userID)
+}
+
+func (c *CachedStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	defer func() {
+		for _, item := range items {
+			c.invalidate(item.ShortPath)
+		}
+	}()
+	return c.backend.DeleteURLs(ctx, items)
+}
+
+func (c *CachedStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	n, err := c.backend.DeleteExpired(ctx, now)
+	if n > 0 {
+		c.purge()
+	}
+	return n, err
+}
+
+func (c *CachedStorage) CountURLs(ctx context.Context) (int, error) {
+	return c.backend.CountURLs(ctx)
+}
+
+func (c *CachedStorage) CountUsers(ctx context.Context) (int, error) {
+	return c.backend.CountUsers(ctx)
+}
+
+// Close закрывает исходное хранилище, если оно этого требует.
+func (c *CachedStorage) Close() error {
+	if closer, ok := c.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// lookup возвращает значение из кэша и переносит его в начало очереди вытеснения.
+// Устаревшая запись удаляется и считается промахом. Вместе с записью возвращается
+// текущее поколение кэша для последующего store.
+func (c *CachedStorage) lookup(short string) (*cacheEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[short]
+	if !ok {
+		return nil, c.gen
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		return nil, c.gen
+	}
+	c.order.MoveToFront(elem)
+	return entry, c.gen
+}
+
+// store сохраняет ответ хранилища, если с момента lookup не было инвалидаций.
+// Время жизни записи ограничено сроком действия ссылки.
+func (c *CachedStorage) store(gen uint64, short string, record URLRecord, err error, ttl time.Duration) {
+	entry := &cacheEntry{short: short, record: record, err: err}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	if record.ExpiresAt != nil && (entry.expiresAt.IsZero() || record.ExpiresAt.Before(entry.expiresAt)) {
+		entry.expiresAt = *record.ExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if elem, ok := c.entries[short]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[short] = c.order.PushFront(entry)
+	for c.order.Len() > c.opts.Size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *CachedStorage) invalidate(short string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if elem, ok := c.entries[short]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *CachedStorage) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	clear(c.entries)
+}
+
+func (c *CachedStorage) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).short)
+}
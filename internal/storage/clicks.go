@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultClickRingSize количество последних переходов, которое хранит MemoryClickStorage.
+const DefaultClickRingSize = 100_000
+
+// ClickEvent один переход по короткой ссылке.
+type ClickEvent struct {
+	ShortPath string    `json:"short_path"`
+	Timestamp time.Time `json:"timestamp"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// IPHash хэш IP-адреса посетителя, сам адрес не сохраняется.
+	IPHash string `json:"ip_hash"`
+}
+
+// DailyClicks количество переходов за сутки (UTC).
+type DailyClicks struct {
+	Date   time.Time
+	Clicks int64
+}
+
+// ClickStats агрегированная статистика переходов по ссылке.
+type ClickStats struct {
+	TotalClicks    int64
+	UniqueVisitors int64
+	Daily          []DailyClicks
+}
+
+// ClickStorage хранит события переходов и считает по ним статистику.
+type ClickStorage interface {
+	SaveClicks(ctx context.Context, events []ClickEvent) error
+	GetClickStats(ctx context.Context, shortPath string) (ClickStats, error)
+}
+
+// clickAggregate накопленная статистика по одной ссылке.
+type clickAggregate struct {
+	total    int64
+	visitors map[string]struct{}
+	daily    map[time.Time]int64
+}
+
+func newClickAggregate() *clickAggregate {
+	return &clickAggregate{
+		visitors: make(map[string]struct{}),
+		daily:    make(map[time.Time]int64),
+	}
+}
+
+func (a *clickAggregate) add(event ClickEvent) {
+	a.total++
+	a.visitors[event.IPHash] = struct{}{}
+	a.daily[truncateDay(event.Timestamp)]++
+}
+
+func (a *clickAggregate) stats() ClickStats {
+	stats := ClickStats{
+		TotalClicks:    a.total,
+		UniqueVisitors: int64(len(a.visitors)),
+		Daily:          make([]DailyClicks, 0, len(a.daily)),
+	}
+	for day, clicks := range a.daily {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: day, Clicks: clicks})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date.Before(stats.Daily[j].Date)
+	})
+	return stats
+}
+
+func truncateDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// MemoryClickStorage хранит последние переходы в кольцевом буфере фиксированного размера.
+// Статистика считается только по событиям, которые еще находятся в буфере.
+type MemoryClickStorage struct {
+	mu     sync.RWMutex
+	events []ClickEvent
+	next   int
+	full   bool
+}
+
+func NewMemoryClickStorage(size int) *MemoryClickStorage {
+	if size <= 0 {
+		size = DefaultClickRingSize
+	}
+	return &MemoryClickStorage{
+		events: make([]ClickEvent, size),
+	}
+}
+
+func (m *MemoryClickStorage) SaveClicks(ctx context.Context, events []ClickEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range events {
+		m.events[m.next] = event
+		m.next = (m.next + 1) % len(m.events)
+		if m.next == 0 {
+			m.full = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryClickStorage) GetClickStats(ctx context.Context, shortPath string) (ClickStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	size := m.next
+	if m.full {
+		size = len(m.events)
+	}
+
+	aggregate := newClickAggregate()
+	for _, event := range m.events[:size] {
+		if event.ShortPath == shortPath {
+			aggregate.add(event)
+		}
+	}
+	return aggregate.stats(), nil
+}
+
+// FileClickStorage дописывает переходы в журнал в формате JSON Lines,
+// а статистику держит в памяти, восстанавливая ее из журнала при запуске.
+type FileClickStorage struct {
+	mu         sync.RWMutex
+	file       *os.File
+	aggregates map[string]*clickAggregate
+}
+
+func NewFileClickStorage(filePath string) (*FileClickStorage, error) {
+	if filePath == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	aggregates, err := replayClicks(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read clicks from file error: %w", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open clicks file error: %w", err)
+	}
+	if err := ensureTrailingNewline(file); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("repair clicks file error: %w", err)
+	}
+
+	return &FileClickStorage{
+		file:       file,
+		aggregates: aggregates,
+	}, nil
+}
+
+// replayClicks восстанавливает статистику из журнала.
+// Поврежденные строки (например, недописанная последняя строка) пропускаются.
+func replayClicks(filePath string) (map[string]*clickAggregate, error) {
+	aggregates := make(map[string]*clickAggregate)
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return aggregates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event ClickEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logger.Log.Warn("Skipping corrupted click record", zap.Error(err))
+			continue
+		}
+		addToAggregates(aggregates, event)
+	}
+
+	return aggregates, scanner.Err()
+}
+
+// ensureTrailingNewline дописывает перевод строки после недописанной последней записи,
+// чтобы новые записи не склеивались с поврежденной.
+func ensureTrailingNewline(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
+
+func addToAggregates(aggregates map[string]*clickAggregate, event ClickEvent) {
+	aggregate, ok := aggregates[event.ShortPath]
+	if !ok {
+		aggregate = newClickAggregate()
+		aggregates[event.ShortPath] = aggregate
+	}
+	aggregate.add(event)
+}
+
+func (f *FileClickStorage) SaveClicks(ctx context.Context, events []ClickEvent) error {
+	var buf []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("serialize click error: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.file.Write(buf); err != nil {
+		return fmt.Errorf("write clicks to file error: %w", err)
+	}
+	for _, event := range events {
+		addToAggregates(f.aggregates, event)
+	}
+	return nil
+}
+
+func (f *FileClickStorage) GetClickStats(ctx context.Context, shortPath string) (ClickStats, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	aggregate, ok := f.aggregates[shortPath]
+	if !ok {
+		return ClickStats{}, nil
+	}
+	return aggregate.stats(), nil
+}
+
+// Close закрывает файл журнала.
+func (f *FileClickStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
@@ -2,6 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/MaxRadzey/shortener/internal/logger"
 	"github.com/MaxRadzey/shortener/internal/utils"
@@ -9,93 +13,288 @@ import (
 	"go.uber.org/zap"
 )
 
+// connectTimeout время на установку первого соединения с PostgreSQL при запуске.
+const connectTimeout = 5 * time.Second
+
 // StorageResult содержит результат инициализации хранилища.
 type StorageResult struct {
 	Storage URLStorage
+	Clicks  ClickStorage
 	DB      *pgxpool.Pool
 }
 
-// InitializeStorage выбирает и инициализирует хранилище согласно приоритетам:
+// Close закрывает хранилища, которым это требуется, и пул соединений с БД.
+func (r *StorageResult) Close() error {
+	var errs []error
+
+	if closer, ok := r.Clicks.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	if closer, ok := r.Storage.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	if r.DB != nil {
+		r.DB.Close()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Режимы выбора хранилища.
+const (
+	// KindAuto пробует PostgreSQL, затем Redis, затем файл, затем память, переходя к следующему при ошибке.
+	// Файл с расширением .db или .bolt открывается как встроенная база.
+	KindAuto = "auto"
+	// KindPostgres, KindRedis, KindEmbedded, KindFile и KindMemory требуют конкретное хранилище
+	// и завершают запуск с ошибкой, если его не удалось инициализировать.
+	KindPostgres = "postgres"
+	KindRedis    = "redis"
+	KindEmbedded = "embedded"
+	KindFile     = "file"
+	KindMemory   = "memory"
+)
+
+// Options параметры инициализации хранилища.
+type Options struct {
+	// Kind режим выбора хранилища, пустое значение равнозначно KindAuto.
+	Kind        string
+	DatabaseDSN string
+	RedisAddr   string
+	FilePath    string
+	File        FileOptions
+	// FailOnMigrationError прерывает запуск, если миграции базы данных не применились.
+	// Иначе ошибка только логируется.
+	FailOnMigrationError bool
+	// QueryTimeout ограничение времени одного запроса к PostgreSQL или Redis, 0 — без ограничения.
+	QueryTimeout time.Duration
+	// Cache параметры кэша чтения ссылок, при нулевом Cache.Size кэш не используется.
+	Cache CacheOptions
+}
+
+// InitializeStorage инициализирует хранилище согласно opts.Kind.
+// В режиме auto хранилища выбираются по приоритетам:
 // 1. PostgreSQL (если указан DATABASE_DSN)
-// 2. Файловое хранилище (если указан FILE_PATH)
-// 3. In-memory (fallback)
-// Возвращает выбранное хранилище и пул соединений БД (может быть nil).
-func InitializeStorage(databaseDSN, filePath string) (*StorageResult, error) {
-	var storage URLStorage
-	var db *pgxpool.Pool
+// 2. Redis (если указан REDIS_ADDR)
+// 3. Встроенная база bbolt или файловое хранилище (если указан FILE_PATH, выбор по расширению)
+// 4. In-memory (fallback)
+// Явно выбранное хранилище при ошибке не подменяется другим, возвращается исходная ошибка.
+func InitializeStorage(opts Options) (*StorageResult, error) {
+	var result *StorageResult
 	var err error
 
-	// Приоритет 1: PostgreSQL
-	if databaseDSN != "" {
-		logger.Log.Info("Attempting to connect to PostgreSQL", zap.String("dsn", utils.MaskDSN(databaseDSN)))
-		db, err = initDatabase(databaseDSN)
-		if err == nil && db != nil {
-			// Запустить миграции используя тот же DSN
-			if err := RunMigrations(databaseDSN); err != nil {
-				logger.Log.Warn("Migrations failed", zap.Error(err))
-			} else {
-				logger.Log.Info("Migrations completed successfully")
-			}
-
-			postgresStorage, err := NewPostgresStorage(db)
-			if err == nil {
-				storage = postgresStorage
-				logger.Log.Info("PostgreSQL storage initialized")
-			} else {
-				logger.Log.Warn("Failed to initialize PostgreSQL storage", zap.Error(err))
-			}
-		} else {
-			logger.Log.Warn("Failed to connect to PostgreSQL, will try fallback storage", zap.Error(err))
+	switch opts.Kind {
+	case KindPostgres:
+		result, err = initPostgres(opts)
+	case KindRedis:
+		result, err = initRedis(opts)
+	case KindEmbedded:
+		result, err = initEmbedded(opts)
+	case KindFile:
+		result, err = initFile(opts)
+	case KindMemory:
+		result = &StorageResult{Storage: NewMemoryStorage()}
+	case KindAuto, "":
+		result, err = initAuto(opts)
+	default:
+		return nil, fmt.Errorf("unknown storage kind %q", opts.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clicks, err := initClickStorage(result.Storage, result.DB, opts)
+	if err != nil {
+		_ = result.Close()
+		return nil, err
+	}
+	result.Clicks = clicks
+
+	// Метрики снимаются под кэшем, чтобы учитывать только обращения к самому хранилищу
+	result.Storage = NewInstrumentedStorage(result.Storage)
+	if opts.Cache.Size > 0 {
+		result.Storage = NewCachedStorage(result.Storage, opts.Cache)
+	}
+
+	kind := opts.Kind
+	if kind == "" {
+		kind = KindAuto
+	}
+	logger.Log.Info("Storage initialized",
+		zap.String("mode", kind),
+		zap.String("backend", BackendName(result.Storage)),
+		zap.Int("cache_size", opts.Cache.Size))
+
+	return result, nil
+}
+
+// initAuto перебирает хранилища по приоритетам, логируя причины перехода к следующему.
+func initAuto(opts Options) (*StorageResult, error) {
+	if opts.DatabaseDSN != "" {
+		result, err := initPostgres(opts)
+		if err == nil {
+			return result, nil
+		}
+		var migrationErr *MigrationError
+		if errors.As(err, &migrationErr) {
+			return nil, err
 		}
+		logger.Log.Warn("Failed to initialize PostgreSQL storage, will try fallback storage", zap.Error(err))
 	}
 
-	// Приоритет 2: Файловое хранилище
-	if storage == nil && filePath != "" {
-		logger.Log.Info("Attempting to use file storage", zap.String("path", filePath))
-		fileStorage, err := NewStorage(filePath)
+	if opts.RedisAddr != "" {
+		result, err := initRedis(opts)
 		if err == nil {
-			storage = fileStorage
-			logger.Log.Info("File storage initialized")
-		} else {
-			logger.Log.Warn("Failed to initialize file storage", zap.Error(err))
+			return result, nil
 		}
+		logger.Log.Warn("Failed to initialize Redis storage, will try fallback storage", zap.Error(err))
 	}
 
-	// Приоритет 3: In-memory (fallback)
-	if storage == nil {
-		logger.Log.Info("Using in-memory storage as fallback")
-		storage = NewMemoryStorage()
+	if opts.FilePath != "" {
+		open := initFile
+		if IsEmbeddedPath(opts.FilePath) {
+			open = initEmbedded
+		}
+		result, err := open(opts)
+		if err == nil {
+			return result, nil
+		}
+		logger.Log.Warn("Failed to initialize file storage, will try fallback storage", zap.Error(err))
 	}
 
-	// Логируем финальный выбор хранилища
-	switch storage.(type) {
+	logger.Log.Info("Using in-memory storage as fallback")
+	return &StorageResult{Storage: NewMemoryStorage()}, nil
+}
+
+// MigrationError возвращается, если миграции не применились при FailOnMigrationError.
+// В режиме auto такая ошибка не приводит к переходу на другое хранилище.
+type MigrationError struct {
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("database migrations failed: %v", e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+func initPostgres(opts Options) (*StorageResult, error) {
+	if opts.DatabaseDSN == "" {
+		return nil, errors.New("database DSN is empty")
+	}
+
+	logger.Log.Info("Connecting to PostgreSQL", zap.String("dsn", utils.MaskDSN(opts.DatabaseDSN)))
+	db, err := initDatabase(opts.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := RunMigrations(opts.DatabaseDSN); err != nil {
+		if opts.FailOnMigrationError {
+			db.Close()
+			return nil, &MigrationError{Err: err}
+		}
+		logger.Log.Warn("Continuing with possibly outdated schema", zap.Error(err))
+	}
+
+	storage, err := NewPostgresStorage(db, opts.QueryTimeout)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &StorageResult{Storage: storage, DB: db}, nil
+}
+
+func initRedis(opts Options) (*StorageResult, error) {
+	if opts.RedisAddr == "" {
+		return nil, errors.New("redis address is empty")
+	}
+
+	logger.Log.Info("Connecting to Redis", zap.String("addr", opts.RedisAddr))
+	storage, err := NewRedisStorage(opts.RedisAddr, opts.QueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageResult{Storage: storage}, nil
+}
+
+func initEmbedded(opts Options) (*StorageResult, error) {
+	if opts.FilePath == "" {
+		return nil, errors.New("file path is empty")
+	}
+
+	logger.Log.Info("Opening embedded storage", zap.String("path", opts.FilePath))
+	storage, err := NewBoltStorage(opts.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageResult{Storage: storage}, nil
+}
+
+func initFile(opts Options) (*StorageResult, error) {
+	if opts.FilePath == "" {
+		return nil, errors.New("file path is empty")
+	}
+
+	logger.Log.Info("Opening file storage", zap.String("path", opts.FilePath))
+	storage, err := NewStorage(opts.FilePath, opts.File)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageResult{Storage: storage}, nil
+}
+
+// BackendName возвращает название хранилища ссылок для логов и диагностики.
+func BackendName(storage URLStorage) string {
+	switch s := storage.(type) {
+	case *CachedStorage:
+		return BackendName(s.Backend())
+	case *InstrumentedStorage:
+		return BackendName(s.Backend())
 	case *PostgresStorage:
-		logger.Log.Info("Storage selected: PostgreSQL")
+		return KindPostgres
+	case *RedisStorage:
+		return KindRedis
+	case *BoltStorage:
+		return KindEmbedded
 	case *Storage:
-		logger.Log.Info("Storage selected: File")
+		return KindFile
 	case *MemoryStorage:
-		logger.Log.Info("Storage selected: In-Memory")
+		return KindMemory
+	default:
+		return "unknown"
 	}
+}
 
-	return &StorageResult{
-		Storage: storage,
-		DB:      db,
-	}, nil
+// initClickStorage выбирает хранилище переходов под выбранное хранилище ссылок:
+// таблицу clicks для PostgreSQL, журнал рядом с файлом данных для файлового и встроенного
+// хранилищ и кольцевой буфер в памяти для остальных случаев, включая Redis.
+func initClickStorage(storage URLStorage, db *pgxpool.Pool, opts Options) (ClickStorage, error) {
+	switch storage.(type) {
+	case *PostgresStorage:
+		return NewPostgresClickStorage(db, opts.QueryTimeout)
+	case *Storage, *BoltStorage:
+		clicksPath := opts.FilePath + ".clicks"
+		logger.Log.Info("Using file click storage", zap.String("path", clicksPath))
+		return NewFileClickStorage(clicksPath)
+	default:
+		return NewMemoryClickStorage(DefaultClickRingSize), nil
+	}
 }
 
-// initDatabase создает подключение к PostgreSQL, если указан DSN.
-// Возвращает пул соединений или nil, если DSN не указан или подключение не удалось.
+// initDatabase создает пул соединений с PostgreSQL и проверяет, что база доступна.
 func initDatabase(dsn string) (*pgxpool.Pool, error) {
-	if dsn == "" {
-		logger.Log.Debug("Database DSN is empty, skipping PostgreSQL connection")
-		return nil, nil
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
 
-	logger.Log.Debug("Creating PostgreSQL connection pool")
-	db, err := pgxpool.New(context.Background(), dsn)
+	db, err := pgxpool.New(ctx, dsn)
 	if err != nil {
-		logger.Log.Warn("Failed to create connection pool", zap.Error(err))
-		return nil, nil
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	logger.Log.Info("Database connection successful")
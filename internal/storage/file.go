@@ -0,0 +1,724 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// FileSyncMode определяет, когда журнал файлового хранилища сбрасывается на диск (fsync).
+type FileSyncMode string
+
+const (
+	// FileSyncAlways сбрасывает журнал после каждой записи.
+	FileSyncAlways FileSyncMode = "always"
+	// FileSyncInterval сбрасывает журнал в фоне раз в FileOptions.SyncInterval.
+	FileSyncInterval FileSyncMode = "interval"
+	// FileSyncNever оставляет сброс на диск операционной системе.
+	FileSyncNever FileSyncMode = "never"
+)
+
+// FileDurability определяет, когда изменения попадают в журнал.
+type FileDurability string
+
+const (
+	// FileDurabilitySync записывает изменения в журнал до ответа клиенту.
+	FileDurabilitySync FileDurability = "sync"
+	// FileDurabilityAsync подтверждает изменения после постановки в очередь,
+	// а в журнал их пачками записывает фоновая горутина (write-behind).
+	FileDurabilityAsync FileDurability = "async"
+)
+
+// ErrStorageClosed возвращается при записи в закрытое хранилище.
+var ErrStorageClosed = errors.New("storage closed")
+
+// minCompactLines минимальное число строк журнала, начиная с которого имеет смысл компактизация.
+const minCompactLines = 1000
+
+// FileOptions настройки файлового хранилища.
+type FileOptions struct {
+	Sync         FileSyncMode
+	SyncInterval time.Duration
+	// CompactInterval период проверки журнала на необходимость компактизации.
+	// Нулевое значение отключает фоновую компактизацию.
+	CompactInterval time.Duration
+
+	// Durability режим записи. В режиме async записи копятся в очереди размером QueueSize
+	// и сбрасываются в журнал при накоплении FlushSize записей или раз в FlushInterval.
+	// Если очередь заполнена, запись блокируется до освобождения места.
+	Durability    FileDurability
+	QueueSize     int
+	FlushSize     int
+	FlushInterval time.Duration
+}
+
+// DefaultFileOptions возвращает настройки файлового хранилища по умолчанию.
+func DefaultFileOptions() FileOptions {
+	return FileOptions{
+		Sync:            FileSyncAlways,
+		SyncInterval:    time.Second,
+		CompactInterval: 10 * time.Minute,
+		Durability:      FileDurabilitySync,
+		QueueSize:       10000,
+		FlushSize:       500,
+		FlushInterval:   200 * time.Millisecond,
+	}
+}
+
+// journalRecord строка журнала файлового хранилища. Более поздняя строка
+// с тем же short_url замещает предыдущую.
+type journalRecord struct {
+	UUID        string     `json:"uuid"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	UserID      string     `json:"user_id,omitempty"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// legacyRecord формат значения в старом файле хранилища (единый JSON объект short_path -> запись).
+type legacyRecord struct {
+	OriginalURL string     `json:"original_url"`
+	UserID      string     `json:"user_id,omitempty"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Storage файловое хранилище. Все изменения дописываются в журнал в формате JSON Lines,
+// актуальное состояние держится в памяти и восстанавливается из журнала при запуске.
+// Журнал периодически компактизируется, чтобы в нем осталась одна строка на ссылку.
+type Storage struct {
+	// writeMu сериализует работу с файлом журнала и берется раньше mu.
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	data    map[string]URLRecord
+	// origins обратный индекс original_url → short_path.
+	origins map[string]string
+
+	filePath string
+	file     *os.File
+	opts     FileOptions
+	// lines количество строк в журнале, dirty — есть записи, не сброшенные на диск.
+	lines int
+	dirty bool
+	// tornErr ошибка неудачного отката частичной записи. Пока журнал не переписан
+	// компактизацией, новые строки склеились бы с недописанной, поэтому запись запрещена.
+	tornErr error
+
+	// pending очередь записей, ожидающих записи в журнал в режиме async.
+	// queueFree сигнализирует об освобождении места в очереди, flushC — о достижении FlushSize.
+	async     bool
+	pending   []URLRecord
+	queueFree *sync.Cond
+	flushC    chan struct{}
+	closed    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewStorage(filePath string, opts FileOptions) (*Storage, error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("file path cannot be empty")
+	}
+
+	data, lines, legacy, err := replayJournal(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read urls from file error: %w", err)
+	}
+
+	s := &Storage{
+		data:     data,
+		origins:  indexOrigins(data),
+		filePath: filePath,
+		opts:     opts,
+		lines:    lines,
+		async:    opts.Durability == FileDurabilityAsync,
+		flushC:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	s.queueFree = sync.NewCond(&s.mu)
+	if s.async && s.opts.QueueSize <= 0 {
+		s.opts.QueueSize = DefaultFileOptions().QueueSize
+	}
+
+	if legacy {
+		// Переписываем старый формат в журнал атомарной заменой файла
+		if err := s.rewrite(); err != nil {
+			return nil, fmt.Errorf("import legacy file error: %w", err)
+		}
+		logger.Log.Info("Imported legacy file storage", zap.String("path", filePath), zap.Int("records", len(data)))
+	} else {
+		file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open file error: %w", err)
+		}
+		if err := ensureTrailingNewline(file); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("repair file error: %w", err)
+		}
+		s.file = file
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run()
+	}()
+
+	return s, nil
+}
+
+// replayJournal восстанавливает состояние из файла хранилища. Файл в старом формате
+// (единый JSON объект) распознается по первой строке, в этом случае legacy = true.
+// Недописанная последняя строка журнала обрезается, поврежденная строка в середине
+// журнала пропускается с предупреждением: после нее могут идти записи, подтвержденные клиентам.
+func replayJournal(filePath string) (data map[string]URLRecord, lines int, legacy bool, err error) {
+	data = make(map[string]URLRecord)
+
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var validSize, offset int64
+	tornLine := 0
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		lineNum++
+		offset += int64(len(line)) + 1
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			validSize = offset
+			continue
+		}
+		if tornLine != 0 {
+			logger.Log.Warn("Skipping corrupted record in file storage",
+				zap.String("path", filePath), zap.Int("line", tornLine))
+			tornLine = 0
+		}
+
+		if lineNum == 1 && isLegacyFormat(line) {
+			data, err = parseLegacy(line)
+			return data, 0, true, err
+		}
+
+		var jr journalRecord
+		if err := json.Unmarshal(line, &jr); err != nil || jr.ShortURL == "" {
+			tornLine = lineNum
+			continue
+		}
+		data[jr.ShortURL] = URLRecord{
+			ShortPath:   jr.ShortURL,
+			OriginalURL: jr.OriginalURL,
+			UserID:      jr.UserID,
+			IsDeleted:   jr.IsDeleted,
+			ExpiresAt:   jr.ExpiresAt,
+		}
+		lines++
+		validSize = offset
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, false, err
+	}
+
+	if tornLine != 0 {
+		logger.Log.Warn("Skipping torn record at the end of file storage",
+			zap.String("path", filePath), zap.Int("line", tornLine))
+		if err := file.Truncate(validSize); err != nil {
+			return nil, 0, false, fmt.Errorf("truncate torn record: %w", err)
+		}
+	}
+
+	return data, lines, false, nil
+}
+
+// isLegacyFormat сообщает, является ли строка файлом старого формата: JSON объектом без поля uuid.
+func isLegacyFormat(line []byte) bool {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return false
+	}
+	_, ok := raw["uuid"]
+	return !ok
+}
+
+// parseLegacy разбирает старый формат файла. Поддерживает как записи с владельцем,
+// так и самый первый формат short_path -> original_url.
+func parseLegacy(line []byte) (map[string]URLRecord, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]URLRecord, len(raw))
+	for short, value := range raw {
+		record := URLRecord{ShortPath: short}
+
+		var legacyURL string
+		if err := json.Unmarshal(value, &legacyURL); err == nil {
+			record.OriginalURL = legacyURL
+			res[short] = record
+			continue
+		}
+
+		var lr legacyRecord
+		if err := json.Unmarshal(value, &lr); err != nil {
+			return nil, fmt.Errorf("decode record %q: %w", short, err)
+		}
+		record.OriginalURL = lr.OriginalURL
+		record.UserID = lr.UserID
+		record.IsDeleted = lr.IsDeleted
+		record.ExpiresAt = lr.ExpiresAt
+		res[short] = record
+	}
+
+	return res, nil
+}
+
+// encodeRecords сериализует записи в строки журнала.
+func encodeRecords(records []URLRecord) ([]byte, error) {
+	var buf []byte
+	for _, record := range records {
+		id, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		line, err := json.Marshal(journalRecord{
+			UUID:        id,
+			ShortURL:    record.ShortPath,
+			OriginalURL: record.OriginalURL,
+			UserID:      record.UserID,
+			IsDeleted:   record.IsDeleted,
+			ExpiresAt:   record.ExpiresAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("serialize url error: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	return buf, nil
+}
+
+// newUUID возвращает случайный UUID версии 4.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// lock захватывает блокировки для изменения данных. В режиме sync изменения
+// сразу пишутся в файл, поэтому дополнительно берется writeMu.
+func (s *Storage) lock() {
+	if !s.async {
+		s.writeMu.Lock()
+	}
+	s.mu.Lock()
+}
+
+func (s *Storage) unlock() {
+	s.mu.Unlock()
+	if !s.async {
+		s.writeMu.Unlock()
+	}
+}
+
+// reserve в режиме async ждет, пока в очереди освободится место под n записей.
+// Вызывать под lock. Пачка больше очереди ждет, пока очередь не опустеет полностью.
+func (s *Storage) reserve(n int) error {
+	if s.closed {
+		return ErrStorageClosed
+	}
+	if !s.async {
+		return nil
+	}
+	for len(s.pending) > 0 && len(s.pending)+n > s.opts.QueueSize {
+		s.requestFlush()
+		s.queueFree.Wait()
+		if s.closed {
+			return ErrStorageClosed
+		}
+	}
+	return nil
+}
+
+// persist записывает измененные записи в журнал (sync) или ставит их в очередь (async).
+// Вызывать под lock после reserve.
+func (s *Storage) persist(records []URLRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if !s.async {
+		return s.appendRecords(records)
+	}
+
+	s.pending = append(s.pending, records...)
+	if len(s.pending) >= s.opts.FlushSize {
+		s.requestFlush()
+	}
+	return nil
+}
+
+func (s *Storage) requestFlush() {
+	select {
+	case s.flushC <- struct{}{}:
+	default:
+	}
+}
+
+// appendRecords дописывает записи в журнал одной операцией записи. Частично
+// записанные при ошибке данные обрезаются, чтобы в журнале не осталось
+// недописанной строки. Вызывать под writeMu.
+func (s *Storage) appendRecords(records []URLRecord) error {
+	if s.tornErr != nil {
+		return fmt.Errorf("file storage is torn: %w", s.tornErr)
+	}
+	buf, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file error: %w", err)
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		if truncErr := s.file.Truncate(info.Size()); truncErr != nil {
+			s.tornErr = truncErr
+			logger.Log.Error("Failed to roll back partial write to file storage",
+				zap.String("path", s.filePath), zap.Error(truncErr))
+		}
+		return fmt.Errorf("write url to file error: %w", err)
+	}
+	s.lines += len(records)
+
+	if s.opts.Sync == FileSyncAlways {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("sync file error: %w", err)
+		}
+		return nil
+	}
+	s.dirty = true
+	return nil
+}
+
+// flush записывает накопленную очередь в журнал. При ошибке записи очередь
+// возвращается обратно, чтобы повторить попытку при следующем сбросе.
+func (s *Storage) flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := s.appendRecords(batch)
+
+	s.mu.Lock()
+	if err != nil {
+		s.pending = append(batch, s.pending...)
+	}
+	s.queueFree.Broadcast()
+	s.mu.Unlock()
+
+	return err
+}
+
+func (s *Storage) Create(ctx context.Context, record URLRecord) error {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.reserve(1); err != nil {
+		return err
+	}
+	created, err := resolveCreate(s.data, s.origins, record)
+	if err != nil {
+		return err
+	}
+	if err := s.persist(created); err != nil {
+		return err
+	}
+	insertRecords(s.data, s.origins, created)
+	return nil
+}
+
+func (s *Storage) Get(ctx context.Context, id string) (string, error) {
+	record, err := s.GetRecord(ctx, id)
+	return record.OriginalURL, err
+}
+
+func (s *Storage) GetRecord(ctx context.Context, id string) (URLRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return activeRecord(s.data, id, time.Now())
+}
+
+func (s *Storage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.reserve(len(records)); err != nil {
+		return nil, err
+	}
+	results, created, err := resolveBatch(s.data, s.origins, records)
+	if err != nil {
+		return nil, err
+	}
+	// Вся пачка попадает в журнал одной записью
+	if err := s.persist(created); err != nil {
+		return nil, err
+	}
+	insertRecords(s.data, s.origins, created)
+	return results, nil
+}
+
+func (s *Storage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return collectUserURLs(s.data, userID), nil
+}
+
+func (s *Storage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	s.lock()
+	defer s.unlock()
+
+	if err := s.reserve(len(items)); err != nil {
+		return err
+	}
+	// Память меняется только после записи в журнал, чтобы при ошибке не расходиться с диском
+	changed := deletedRecords(s.data, items)
+	if err := s.persist(changed); err != nil {
+		return err
+	}
+	applyDeleted(s.data, s.origins, changed)
+	return nil
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.lock()
+	defer s.unlock()
+
+	if s.closed {
+		return 0, ErrStorageClosed
+	}
+	changed := expiredRecords(s.data, now)
+	if err := s.persist(changed); err != nil {
+		return 0, err
+	}
+	applyDeleted(s.data, s.origins, changed)
+	return int64(len(changed)), nil
+}
+
+func (s *Storage) CountURLs(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return countURLs(s.data), nil
+}
+
+func (s *Storage) CountUsers(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return countUsers(s.data), nil
+}
+
+// Compact переписывает журнал так, чтобы в нем осталась одна строка на каждую ссылку.
+func (s *Storage) Compact() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rewrite()
+}
+
+// rewrite записывает текущее состояние во временный файл и атомарно заменяет им журнал.
+// Состояние в памяти уже включает очередь async, поэтому она очищается.
+// Вызывать под writeMu и mu.
+func (s *Storage) rewrite() error {
+	records := make([]URLRecord, 0, len(s.data))
+	for _, record := range s.data {
+		records = append(records, record)
+	}
+	buf, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.filePath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write temp file error: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("sync temp file error: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file error: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.filePath); err != nil {
+		return fmt.Errorf("replace file error: %w", err)
+	}
+	syncDir(filepath.Dir(s.filePath))
+
+	file, err := os.OpenFile(s.filePath, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open file error: %w", err)
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = file
+	s.lines = len(records)
+	s.dirty = false
+	s.tornErr = nil
+	if len(s.pending) > 0 {
+		s.pending = nil
+		s.queueFree.Broadcast()
+	}
+	return nil
+}
+
+// syncDir сбрасывает на диск запись каталога, чтобы переименование файла пережило сбой.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
+
+// needsCompaction сообщает, что журнал разросся более чем вдвое относительно числа ссылок.
+// Вызывать под блокировкой.
+func (s *Storage) needsCompaction() bool {
+	return s.lines >= minCompactLines && s.lines > 2*len(s.data)
+}
+
+// run периодически сбрасывает журнал на диск и компактизирует его до вызова Close.
+// В режиме async также записывает очередь в журнал.
+func (s *Storage) run() {
+	var syncC, compactC, flushC <-chan time.Time
+	if s.opts.Sync == FileSyncInterval && s.opts.SyncInterval > 0 {
+		ticker := time.NewTicker(s.opts.SyncInterval)
+		defer ticker.Stop()
+		syncC = ticker.C
+	}
+	if s.opts.CompactInterval > 0 {
+		ticker := time.NewTicker(s.opts.CompactInterval)
+		defer ticker.Stop()
+		compactC = ticker.C
+	}
+	if s.async && s.opts.FlushInterval > 0 {
+		ticker := time.NewTicker(s.opts.FlushInterval)
+		defer ticker.Stop()
+		flushC = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-flushC:
+			s.flushLogged()
+		case <-s.flushC:
+			s.flushLogged()
+		case <-syncC:
+			if err := s.sync(); err != nil {
+				logger.Log.Error("Failed to sync file storage", zap.Error(err))
+			}
+		case <-compactC:
+			s.writeMu.Lock()
+			s.mu.Lock()
+			var err error
+			if s.needsCompaction() {
+				err = s.rewrite()
+			}
+			s.mu.Unlock()
+			s.writeMu.Unlock()
+			if err != nil {
+				logger.Log.Error("Failed to compact file storage", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *Storage) flushLogged() {
+	if err := s.flush(); err != nil {
+		logger.Log.Error("Failed to flush file storage queue", zap.Error(err))
+	}
+}
+
+// sync сбрасывает на диск записи, накопленные с момента предыдущего сброса.
+func (s *Storage) sync() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Close останавливает фоновые задачи, записывает оставшуюся очередь,
+// сбрасывает журнал на диск и закрывает файл.
+func (s *Storage) Close() error {
+	// Сначала запрещаем новые записи, чтобы после финального сброса очередь не пополнялась
+	s.mu.Lock()
+	s.closed = true
+	s.queueFree.Broadcast()
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+
+	flushErr := s.flush()
+	if flushErr != nil {
+		flushErr = fmt.Errorf("flush queue error: %w", flushErr)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return errors.Join(flushErr, s.file.Sync(), s.file.Close())
+}
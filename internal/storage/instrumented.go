@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/MaxRadzey/shortener/internal/metrics"
+	"github.com/MaxRadzey/shortener/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// InstrumentedStorage оборачивает хранилище ссылок: каждая операция получает
+// спан трассировки и метрики времени выполнения и сбоев с меткой бэкенда.
+type InstrumentedStorage struct {
+	backend URLStorage
+	name    string
+}
+
+func NewInstrumentedStorage(backend URLStorage) *InstrumentedStorage {
+	return &InstrumentedStorage{backend: backend, name: BackendName(backend)}
+}
+
+// Backend возвращает исходное хранилище.
+func (s *InstrumentedStorage) Backend() URLStorage {
+	return s.backend
+}
+
+func (s *InstrumentedStorage) Get(ctx context.Context, short string) (string, error) {
+	ctx, done := s.start(ctx, "get")
+	url, err := s.backend.Get(ctx, short)
+	done(err)
+	return url, err
+}
+
+func (s *InstrumentedStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
+	ctx, done := s.start(ctx, "get")
+	record, err := s.backend.GetRecord(ctx, short)
+	done(err)
+	return record, err
+}
+
+func (s *InstrumentedStorage) Create(ctx context.Context, record URLRecord) error {
+	ctx, done := s.start(ctx, "create")
+	err := s.backend.Create(ctx, record)
+	done(err)
+	return err
+}
+
+func (s *InstrumentedStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	ctx, done := s.start(ctx, "create_batch")
+	results, err := s.backend.CreateBatch(ctx, records)
+	done(err)
+	return results, err
+}
+
+func (s *InstrumentedStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	ctx, done := s.start(ctx, "get_user_urls")
+	records, err := s.backend.GetUserURLs(ctx, userID)
+	done(err)
+	return records, err
+}
+
+func (s *InstrumentedStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	ctx, done := s.start(ctx, "delete_urls")
+	err := s.backend.DeleteURLs(ctx, items)
+	done(err)
+	return err
+}
+
+func (s *InstrumentedStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, done := s.start(ctx, "delete_expired")
+	n, err := s.backend.DeleteExpired(ctx, now)
+	done(err)
+	return n, err
+}
+
+func (s *InstrumentedStorage) CountURLs(ctx context.Context) (int, error) {
+	ctx, done := s.start(ctx, "count_urls")
+	n, err := s.backend.CountURLs(ctx)
+	done(err)
+	return n, err
+}
+
+func (s *InstrumentedStorage) CountUsers(ctx context.Context) (int, error) {
+	ctx, done := s.start(ctx, "count_users")
+	n, err := s.backend.CountUsers(ctx)
+	done(err)
+	return n, err
+}
+
+// Close закрывает исходное хранилище, если оно этого требует.
+func (s *InstrumentedStorage) Close() error {
+	if closer, ok := s.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// start открывает спан операции и возвращает функцию, которая по ее результату
+// закрывает спан и снимает метрики.
+func (s *InstrumentedStorage) start(ctx context.Context, operation string) (context.Context, func(error)) {
+	started := time.Now()
+	ctx, span := tracing.Start(ctx, "storage."+operation, attribute.String("storage.backend", s.name))
+	return ctx, func(err error) {
+		failed := isFailure(err)
+		if failed {
+			tracing.Fail(span, err)
+		}
+		span.End()
+		metrics.ObserveStorage(s.name, operation, started, failed)
+	}
+}
+
+// isFailure отделяет сбои хранилища от ошибок, которыми хранилище сообщает
+// ожидаемый результат: ссылка не найдена, удалена, истекла или уже существует.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrDeleted) || errors.Is(err, ErrExpired) {
+		return false
+	}
+	var existsErr *ErrURLAlreadyExists
+	var collisionErr *ErrShortPathCollision
+	return !errors.As(err, &existsErr) && !errors.As(err, &collisionErr)
+}
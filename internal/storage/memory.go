@@ -2,48 +2,271 @@ package storage
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 )
 
 type MemoryStorage struct {
 	mu   sync.RWMutex
-	data map[string]string
+	data map[string]URLRecord
+	// origins обратный индекс original_url → short_path.
+	origins map[string]string
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		data: make(map[string]string),
+		data:    make(map[string]URLRecord),
+		origins: make(map[string]string),
 	}
 }
 
-func (m *MemoryStorage) Get(short string) (string, error) {
+func (m *MemoryStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := m.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
+
+func (m *MemoryStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	url, ok := m.data[short]
-	if !ok {
-		return "", ErrNotFound
+	return activeRecord(m.data, short, time.Now())
+}
+
+func (m *MemoryStorage) Create(ctx context.Context, record URLRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created, err := resolveCreate(m.data, m.origins, record)
+	if err != nil {
+		return err
 	}
+	insertRecords(m.data, m.origins, created)
+	return nil
+}
 
-	return url, nil
+func (m *MemoryStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results, created, err := resolveBatch(m.data, m.origins, records)
+	if err != nil {
+		return nil, err
+	}
+
+	// Атомарно добавляем все записи в map
+	insertRecords(m.data, m.origins, created)
+	return results, nil
 }
 
-func (m *MemoryStorage) Create(short, full string) error {
+func (m *MemoryStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return collectUserURLs(m.data, userID), nil
+}
+
+func (m *MemoryStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.data[short] = full
+	applyDeleted(m.data, m.origins, deletedRecords(m.data, items))
 	return nil
 }
 
-func (m *MemoryStorage) CreateBatch(ctx context.Context, items []BatchItem) error {
+func (m *MemoryStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Атомарно добавляем все записи в map
+	changed := expiredRecords(m.data, now)
+	applyDeleted(m.data, m.origins, changed)
+	return int64(len(changed)), nil
+}
+
+func (m *MemoryStorage) CountURLs(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countURLs(m.data), nil
+}
+
+func (m *MemoryStorage) CountUsers(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countUsers(m.data), nil
+}
+
+// activeRecord возвращает запись, если она существует, не удалена и не истекла к моменту now.
+func activeRecord(data map[string]URLRecord, short string, now time.Time) (URLRecord, error) {
+	record, ok := data[short]
+	if !ok {
+		return URLRecord{}, ErrNotFound
+	}
+	if record.IsDeleted {
+		return URLRecord{}, ErrDeleted
+	}
+	if record.Expired(now) {
+		return URLRecord{}, ErrExpired
+	}
+	return record, nil
+}
+
+// countURLs считает неудаленные записи.
+func countURLs(data map[string]URLRecord) int {
+	count := 0
+	for _, record := range data {
+		if !record.IsDeleted {
+			count++
+		}
+	}
+	return count
+}
+
+// countUsers считает уникальных владельцев неудаленных записей. Анонимные записи не учитываются.
+func countUsers(data map[string]URLRecord) int {
+	users := make(map[string]struct{})
+	for _, record := range data {
+		if record.UserID != "" && !record.IsDeleted {
+			users[record.UserID] = struct{}{}
+		}
+	}
+	return len(users)
+}
+
+// expiredRecords возвращает копии ссылок с истекшим сроком действия, помеченные удаленными.
+// data не изменяется: вызывающий применяет записи через applyDeleted после их сохранения.
+func expiredRecords(data map[string]URLRecord, now time.Time) []URLRecord {
+	var changed []URLRecord
+	for _, record := range data {
+		if record.IsDeleted || !record.Expired(now) {
+			continue
+		}
+		record.IsDeleted = true
+		changed = append(changed, record)
+	}
+	return changed
+}
+
+// resolveBatch определяет, какие записи пачки нужно создать. Уже сокращенные URL,
+// в том числе повторяющиеся внутри пачки, получают существующий короткий путь.
+// Истекшая, но еще не очищенная ссылка URL не занимает, индекс перезапишет новая запись.
+// Короткий путь, занятый в хранилище или внутри пачки, приводит к ErrShortPathCollision.
+func resolveBatch(data map[string]URLRecord, origins map[string]string, records []URLRecord) ([]BatchItemResult, []URLRecord, error) {
+	results := make([]BatchItemResult, len(records))
+	pending := make(map[string]string, len(records))
+	pendingShorts := make(map[string]struct{}, len(records))
+	var created []URLRecord
+	now := time.Now()
+
+	for i, record := range records {
+		if short, ok := origins[record.OriginalURL]; ok && data[short].Active(now) {
+			results[i] = BatchItemResult{ShortPath: short, Existed: true}
+			continue
+		}
+		if short, ok := pending[record.OriginalURL]; ok {
+			results[i] = BatchItemResult{ShortPath: short, Existed: true}
+			continue
+		}
+		if _, ok := data[record.ShortPath]; ok {
+			return nil, nil, &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+		if _, ok := pendingShorts[record.ShortPath]; ok {
+			return nil, nil, &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+
+		pending[record.OriginalURL] = record.ShortPath
+		pendingShorts[record.ShortPath] = struct{}{}
+		results[i] = BatchItemResult{ShortPath: record.ShortPath}
+		created = append(created, record)
+	}
+	return results, created, nil
+}
+
+// resolveCreate проверяет одиночную запись по тем же правилам, что и resolveBatch,
+// и превращает уже сокращенный URL в ErrURLAlreadyExists.
+func resolveCreate(data map[string]URLRecord, origins map[string]string, record URLRecord) ([]URLRecord, error) {
+	results, created, err := resolveBatch(data, origins, []URLRecord{record})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Existed {
+		return nil, &ErrURLAlreadyExists{ShortPath: results[0].ShortPath}
+	}
+	return created, nil
+}
+
+// insertRecords добавляет новые записи и обновляет обратный индекс.
+func insertRecords(data map[string]URLRecord, origins map[string]string, records []URLRecord) {
+	for _, record := range records {
+		data[record.ShortPath] = record
+		origins[record.OriginalURL] = record.ShortPath
+	}
+}
+
+// applyDeleted сохраняет помеченные удаленными записи и убирает их из обратного индекса,
+// чтобы их URL можно было сократить заново. Запись индекса, уже указывающая на другой путь,
+// не трогается.
+func applyDeleted(data map[string]URLRecord, origins map[string]string, records []URLRecord) {
+	for _, record := range records {
+		data[record.ShortPath] = record
+		if origins[record.OriginalURL] == record.ShortPath {
+			delete(origins, record.OriginalURL)
+		}
+	}
+}
+
+// indexOrigins строит обратный индекс по неудаленным записям. Если URL сокращен
+// несколько раз (данные до появления дедупликации), выбирается наименьший короткий путь.
+func indexOrigins(data map[string]URLRecord) map[string]string {
+	origins := make(map[string]string, len(data))
+	for short, record := range data {
+		if record.IsDeleted {
+			continue
+		}
+		if existing, ok := origins[record.OriginalURL]; !ok || short < existing {
+			origins[record.OriginalURL] = short
+		}
+	}
+	return origins
+}
+
+// deletedRecords возвращает копии записей указанных пользователей, помеченные удаленными.
+// data не изменяется: вызывающий применяет записи через applyDeleted после их сохранения.
+func deletedRecords(data map[string]URLRecord, items []DeleteItem) []URLRecord {
+	var changed []URLRecord
+	seen := make(map[string]struct{}, len(items))
 	for _, item := range items {
-		m.data[item.ShortPath] = item.FullURL
+		record, ok := data[item.ShortPath]
+		if !ok || record.IsDeleted || record.UserID == "" || record.UserID != item.UserID {
+			continue
+		}
+		if _, ok := seen[item.ShortPath]; ok {
+			continue
+		}
+		seen[item.ShortPath] = struct{}{}
+		record.IsDeleted = true
+		changed = append(changed, record)
 	}
+	return changed
+}
 
-	return nil
+// collectUserURLs выбирает записи пользователя, отсортированные по короткому пути.
+func collectUserURLs(data map[string]URLRecord, userID string) []URLRecord {
+	if userID == "" {
+		return nil
+	}
+
+	now := time.Now()
+	var records []URLRecord
+	for _, record := range data {
+		if record.UserID == userID && !record.IsDeleted && !record.Expired(now) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ShortPath < records[j].ShortPath
+	})
+	return records
 }
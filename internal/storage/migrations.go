@@ -4,70 +4,126 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"path/filepath"
 
 	"github.com/MaxRadzey/shortener/internal/logger"
+	"github.com/MaxRadzey/shortener/migrations"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
 
-// RunMigrations запускает миграции базы данных из директории migrations.
-// Принимает DSN строку подключения и создает временное подключение через *sql.DB,
-// необходимое для golang-migrate (библиотека не поддерживает pgxpool напрямую).
-// Если миграции уже применены, функция возвращает nil.
-func RunMigrations(dsn string) error {
-	if dsn == "" {
-		return nil
-	}
-
-	logger.Log.Info("Starting database migrations")
+// Migrator применяет встроенные в бинарный файл миграции к базе данных.
+type Migrator struct {
+	m  *migrate.Migrate
+	db *sql.DB
+}
 
-	// Получаем абсолютный путь к директории migrations
-	migrationsPath, err := filepath.Abs("migrations")
+// NewMigrator создает мигратор для базы по DSN. Открывает временное подключение через *sql.DB,
+// необходимое для golang-migrate (библиотека не поддерживает pgxpool напрямую).
+// После использования мигратор нужно закрыть.
+func NewMigrator(dsn string) (*Migrator, error) {
+	source, err := iofs.New(migrations.FS, ".")
 	if err != nil {
-		logger.Log.Error("Failed to get migrations path", zap.Error(err))
-		return fmt.Errorf("failed to get migrations path: %w", err)
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
 	}
-	logger.Log.Debug("Migrations path", zap.String("path", migrationsPath))
 
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		logger.Log.Error("Failed to open database for migrations", zap.Error(err))
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	defer db.Close()
 
 	// Создаем экземпляр драйвера PostgreSQL для миграций
 	instance, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		logger.Log.Error("Failed to create postgres instance for migrations", zap.Error(err))
-		return fmt.Errorf("failed to create postgres instance: %w", err)
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create postgres instance: %w", err)
 	}
 
-	// Создаем экземпляр мигратора
-	m, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", migrationsPath),
-		"postgres", instance)
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", instance)
 	if err != nil {
-		logger.Log.Error("Failed to create migrate instance", zap.Error(err))
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
 	}
 
-	// Запускаем миграции
-	logger.Log.Info("Running migrations")
-	err = m.Up()
-	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	return &Migrator{m: m, db: db}, nil
+}
+
+// Up применяет все новые миграции. Отсутствие новых миграций ошибкой не считается.
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down откатывает steps последних миграций.
+func (m *Migrator) Down(steps int) error {
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Version возвращает текущую версию схемы. Если миграции не применялись, applied = false.
+func (m *Migrator) Version() (version uint, dirty bool, applied bool, err error) {
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, false, nil
+	}
+	if err != nil {
+		return 0, false, false, err
+	}
+	return version, dirty, true, nil
+}
+
+// Force устанавливает версию схемы без выполнения миграций и снимает признак dirty.
+// Используется для ручного восстановления после неудачной миграции.
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Close закрывает подключение к базе.
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr, m.db.Close())
+}
+
+// RunMigrations применяет встроенные миграции к базе по DSN.
+// Если миграции уже применены, функция возвращает nil.
+func RunMigrations(dsn string) error {
+	if dsn == "" {
+		return nil
+	}
+
+	logger.Log.Info("Starting database migrations")
+
+	migrator, err := NewMigrator(dsn)
+	if err != nil {
+		logger.Log.Error("Failed to prepare migrations", zap.Error(err))
+		return err
+	}
+	defer migrator.Close()
+
+	before, _, _, err := migrator.Version()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if err := migrator.Up(); err != nil {
 		logger.Log.Error("Migrations failed", zap.Error(err))
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	if errors.Is(err, migrate.ErrNoChange) {
-		logger.Log.Info("Migrations already applied, no changes needed")
+	after, _, _, err := migrator.Version()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if before == after {
+		logger.Log.Info("Migrations already applied, no changes needed", zap.Uint("version", after))
 	} else {
-		logger.Log.Info("Migrations completed successfully")
+		logger.Log.Info("Migrations completed successfully", zap.Uint("from", before), zap.Uint("to", after))
 	}
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -11,51 +12,100 @@ import (
 )
 
 type PostgresStorage struct {
-	db *pgxpool.Pool
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewPostgresStorage(db *pgxpool.Pool) (*PostgresStorage, error) {
+// NewPostgresStorage создает хранилище поверх пула соединений. Каждый запрос ограничен
+// временем queryTimeout в дополнение к контексту вызова; нулевое значение снимает ограничение.
+func NewPostgresStorage(db *pgxpool.Pool, queryTimeout time.Duration) (*PostgresStorage, error) {
 	if db == nil {
 		return nil, errors.New("database connection is nil")
 	}
 
 	// Проверяем соединение
-	ctx := context.Background()
+	ctx, cancel := withQueryTimeout(context.Background(), queryTimeout)
+	defer cancel()
 	if err := db.Ping(ctx); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	return &PostgresStorage{
-		db: db,
+		db:           db,
+		queryTimeout: queryTimeout,
 	}, nil
 }
 
-func (p *PostgresStorage) Get(short string) (string, error) {
-	ctx := context.Background()
-	var originalURL string
+// withQueryTimeout ограничивает контекст запроса к базе временем timeout, если оно задано.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (p *PostgresStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := p.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
 
-	err := p.db.QueryRow(ctx, "SELECT original_url FROM urls WHERE short_path = $1", short).Scan(&originalURL)
+func (p *PostgresStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	record := URLRecord{ShortPath: short}
+	err := p.db.QueryRow(ctx,
+		"SELECT original_url, COALESCE(user_id, ''), is_deleted, expires_at FROM urls WHERE short_path = $1", short).
+		Scan(&record.OriginalURL, &record.UserID, &record.IsDeleted, &record.ExpiresAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", ErrNotFound
+			return URLRecord{}, ErrNotFound
 		}
-		return "", fmt.Errorf("failed to get URL: %w", err)
+		return URLRecord{}, fmt.Errorf("failed to get URL: %w", err)
 	}
-
-	return originalURL, nil
+	if record.IsDeleted {
+		return URLRecord{}, ErrDeleted
+	}
+	if record.Expired(time.Now()) {
+		return URLRecord{}, ErrExpired
+	}
+	return record, nil
 }
 
-func (p *PostgresStorage) Create(short, full string) error {
-	ctx := context.Background()
+// retireExpiredSQL помечает удаленными истекшие, но еще не очищенные ссылки на URL из $1,
+// чтобы они не мешали сократить URL заново: уникальный индекс original_url действует
+// только для неудаленных ссылок.
+const retireExpiredSQL = "UPDATE urls SET is_deleted = TRUE WHERE original_url = ANY($1) AND NOT is_deleted AND expires_at <= $2"
+
+func (p *PostgresStorage) Create(ctx context.Context, record URLRecord) error {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
 
-	_, err := p.db.Exec(ctx, "INSERT INTO urls (short_path, original_url) VALUES ($1, $2)", short, full)
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
-		// Проверяем, является ли ошибка нарушением уникального ограничения на original_url
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, retireExpiredSQL, []string{record.OriginalURL}, time.Now()); err != nil {
+		return fmt.Errorf("failed to retire expired URL: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO urls (short_path, original_url, user_id, expires_at) VALUES ($1, $2, NULLIF($3, ''), $4)",
+		record.ShortPath, record.OriginalURL, record.UserID, record.ExpiresAt)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		// Нарушение уникальности: либо original_url уже сокращен, либо short_path занят другим URL
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			// Получаем существующий short_path для данного original_url
 			var existingShortPath string
-			queryErr := p.db.QueryRow(ctx, "SELECT short_path FROM urls WHERE original_url = $1", full).Scan(&existingShortPath)
+			queryErr := p.db.QueryRow(ctx, "SELECT short_path FROM urls WHERE original_url = $1 AND NOT is_deleted", record.OriginalURL).Scan(&existingShortPath)
+			if errors.Is(queryErr, pgx.ErrNoRows) {
+				return &ErrShortPathCollision{ShortPath: record.ShortPath}
+			}
 			if queryErr != nil {
 				return fmt.Errorf("failed to get existing short_path: %w", queryErr)
 			}
@@ -67,39 +117,239 @@ func (p *PostgresStorage) Create(short, full string) error {
 	return nil
 }
 
-func (p *PostgresStorage) CreateBatch(ctx context.Context, items []BatchItem) error {
+func (p *PostgresStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
 	// Используем транзакцию для атомарности
 	tx, err := p.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	// Подготавливаем batch insert с множественными VALUES
+	originalURLs := make([]string, 0, len(records))
+	for _, record := range records {
+		originalURLs = append(originalURLs, record.OriginalURL)
+	}
+	if _, err := tx.Exec(ctx, retireExpiredSQL, originalURLs, time.Now()); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to retire expired URLs: %w", err)
+	}
+
+	// Конфликт по любому уникальному индексу (short_path или original_url) пропускает запись,
+	// причина выясняется после выполнения пачки
 	batch := &pgx.Batch{}
-	for _, item := range items {
-		batch.Queue("INSERT INTO urls (short_path, original_url) VALUES ($1, $2) ON CONFLICT (short_path) DO NOTHING", item.ShortPath, item.FullURL)
+	for _, record := range records {
+		batch.Queue(
+			"INSERT INTO urls (short_path, original_url, user_id, expires_at) VALUES ($1, $2, NULLIF($3, ''), $4) ON CONFLICT DO NOTHING",
+			record.ShortPath, record.OriginalURL, record.UserID, record.ExpiresAt)
 	}
 
-	results := tx.SendBatch(ctx, batch)
+	batchResults := tx.SendBatch(ctx, batch)
 
-	// Выполняем все запросы
-	for i := 0; i < len(items); i++ {
-		_, err := results.Exec()
+	// Выполняем все запросы и запоминаем записи, которые не были вставлены
+	results := make([]BatchItemResult, len(records))
+	var skipped []int
+	for i := range records {
+		tag, err := batchResults.Exec()
 		if err != nil {
-			results.Close()
+			batchResults.Close()
 			tx.Rollback(ctx)
-			return fmt.Errorf("failed to insert batch item: %w", err)
+			return nil, fmt.Errorf("failed to insert batch item: %w", err)
+		}
+		results[i].ShortPath = records[i].ShortPath
+		if tag.RowsAffected() == 0 {
+			skipped = append(skipped, i)
 		}
 	}
 
-	if err := results.Close(); err != nil {
+	if err := batchResults.Close(); err != nil {
 		tx.Rollback(ctx)
-		return fmt.Errorf("failed to close batch results: %w", err)
+		return nil, fmt.Errorf("failed to close batch results: %w", err)
+	}
+
+	// Пропущенная запись либо повторяет уже сокращенный URL, либо упирается в занятый short_path
+	for _, i := range skipped {
+		var existingShortPath string
+		err := tx.QueryRow(ctx, "SELECT short_path FROM urls WHERE original_url = $1 AND NOT is_deleted", records[i].OriginalURL).Scan(&existingShortPath)
+		if errors.Is(err, pgx.ErrNoRows) {
+			tx.Rollback(ctx)
+			return nil, &ErrShortPathCollision{ShortPath: records[i].ShortPath}
+		}
+		if err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to get existing short_path: %w", err)
+		}
+		results[i] = BatchItemResult{ShortPath: existingShortPath, Existed: true}
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+func (p *PostgresStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	rows, err := p.db.Query(ctx, `
+		SELECT short_path, original_url, expires_at FROM urls
+		WHERE user_id = $1 AND NOT is_deleted AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY id`, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var records []URLRecord
+	for rows.Next() {
+		record := URLRecord{UserID: userID}
+		if err := rows.Scan(&record.ShortPath, &record.OriginalURL, &record.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user URL: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read user URLs: %w", err)
+	}
+
+	return records, nil
+}
+
+// DeleteURLs помечает ссылки удаленными одним запросом UPDATE для всей пачки.
+func (p *PostgresStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	shortPaths := make([]string, 0, len(items))
+	userIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		shortPaths = append(shortPaths, item.ShortPath)
+		userIDs = append(userIDs, item.UserID)
+	}
+
+	_, err := p.db.Exec(ctx, `
+		UPDATE urls SET is_deleted = TRUE
+		FROM unnest($1::text[], $2::text[]) AS d(short_path, user_id)
+		WHERE urls.short_path = d.short_path AND urls.user_id = d.user_id AND NOT urls.is_deleted`,
+		shortPaths, userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete URLs: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	tag, err := p.db.Exec(ctx,
+		"UPDATE urls SET is_deleted = TRUE WHERE NOT is_deleted AND expires_at <= $1", now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired URLs: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (p *PostgresStorage) CountURLs(ctx context.Context) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var count int
+	err := p.db.QueryRow(ctx, "SELECT COUNT(*) FROM urls WHERE NOT is_deleted").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count URLs: %w", err)
+	}
+	return count, nil
+}
+
+func (p *PostgresStorage) CountUsers(ctx context.Context) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var count int
+	err := p.db.QueryRow(ctx, "SELECT COUNT(DISTINCT user_id) FROM urls WHERE user_id IS NOT NULL AND NOT is_deleted").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// PostgresClickStorage хранит переходы в таблице clicks.
+type PostgresClickStorage struct {
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+func NewPostgresClickStorage(db *pgxpool.Pool, queryTimeout time.Duration) (*PostgresClickStorage, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+	return &PostgresClickStorage{db: db, queryTimeout: queryTimeout}, nil
+}
+
+// SaveClicks записывает пачку переходов через COPY.
+func (p *PostgresClickStorage) SaveClicks(ctx context.Context, events []ClickEvent) error {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	rows := make([][]any, 0, len(events))
+	for _, event := range events {
+		rows = append(rows, []any{event.ShortPath, event.Timestamp, event.Referrer, event.UserAgent, event.IPHash})
+	}
+
+	_, err := p.db.CopyFrom(ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"short_path", "clicked_at", "referrer", "user_agent", "ip_hash"},
+		pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to save clicks: %w", err)
 	}
 
 	return nil
 }
+
+func (p *PostgresClickStorage) GetClickStats(ctx context.Context, shortPath string) (ClickStats, error) {
+	ctx, cancel := withQueryTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var stats ClickStats
+
+	err := p.db.QueryRow(ctx,
+		"SELECT count(*), count(DISTINCT ip_hash) FROM clicks WHERE short_path = $1", shortPath).
+		Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		return ClickStats{}, fmt.Errorf("failed to get click totals: %w", err)
+	}
+
+	rows, err := p.db.Query(ctx, `
+		SELECT date_trunc('day', clicked_at AT TIME ZONE 'UTC') AS day, count(*)
+		FROM clicks WHERE short_path = $1
+		GROUP BY day ORDER BY day`, shortPath)
+	if err != nil {
+		return ClickStats{}, fmt.Errorf("failed to get daily clicks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var daily DailyClicks
+		if err := rows.Scan(&daily.Date, &daily.Clicks); err != nil {
+			return ClickStats{}, fmt.Errorf("failed to scan daily clicks: %w", err)
+		}
+		daily.Date = time.Date(daily.Date.Year(), daily.Date.Month(), daily.Date.Day(), 0, 0, 0, 0, time.UTC)
+		stats.Daily = append(stats.Daily, daily)
+	}
+	if err := rows.Err(); err != nil {
+		return ClickStats{}, fmt.Errorf("failed to read daily clicks: %w", err)
+	}
+
+	return stats, nil
+}
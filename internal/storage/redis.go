@@ -0,0 +1,506 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ключи Redis. Запись ссылки хранится JSON-строкой kvRecord по ключу redisURLKey,
+// обратный индекс original_url → short_path — строкой по ключу redisOriginKey.
+const (
+	redisKeyPrefix = "shortener:"
+	// redisURLsKey множество коротких путей неудаленных ссылок.
+	redisURLsKey = redisKeyPrefix + "urls"
+	// redisUsersKey множество пользователей, создавших хотя бы одну ссылку, включая удаленные.
+	redisUsersKey = redisKeyPrefix + "users"
+	// redisExpiryKey сортированное множество ссылок со сроком действия, score — unix-время истечения.
+	redisExpiryKey = redisKeyPrefix + "expiry"
+)
+
+func redisURLKey(short string) string { return redisKeyPrefix + "url:" + short }
+
+func redisOriginKey(originalURL string) string { return redisKeyPrefix + "origin:" + originalURL }
+
+func redisUserKey(userID string) string { return redisKeyPrefix + "user:" + userID }
+
+// maxOriginAttempts количество попыток занять обратный индекс, который параллельно
+// освобождается или занимается другими запросами.
+const maxOriginAttempts = 5
+
+// errOriginChanged прерывает транзакцию releaseOrigin, если индекс уже изменен.
+var errOriginChanged = errors.New("original_url index changed")
+
+// RedisStorage хранит ссылки в Redis или совместимом по протоколу RESP сервере.
+// Операции не транзакционны: создание занимает обратный индекс и короткий путь
+// через SET NX и откатывает индекс при коллизии пути. Индекс удаленной или истекшей
+// ссылки снимается через WATCH/MULTI, только если он все еще указывает на нее.
+type RedisStorage struct {
+	client       *redis.Client
+	queryTimeout time.Duration
+}
+
+// NewRedisStorage подключается к Redis по адресу addr (host:port) и проверяет соединение.
+func NewRedisStorage(addr string, queryTimeout time.Duration) (*RedisStorage, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStorage{client: client, queryTimeout: queryTimeout}, nil
+}
+
+func (r *RedisStorage) Get(ctx context.Context, short string) (string, error) {
+	record, err := r.GetRecord(ctx, short)
+	return record.OriginalURL, err
+}
+
+func (r *RedisStorage) GetRecord(ctx context.Context, short string) (URLRecord, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	record, err := r.getRecord(ctx, short)
+	if err != nil {
+		return URLRecord{}, err
+	}
+	if record.IsDeleted {
+		return URLRecord{}, ErrDeleted
+	}
+	if record.Expired(time.Now()) {
+		return URLRecord{}, ErrExpired
+	}
+	return record, nil
+}
+
+func (r *RedisStorage) Create(ctx context.Context, record URLRecord) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	value, err := json.Marshal(toKVRecord(record))
+	if err != nil {
+		return fmt.Errorf("failed to encode URL: %w", err)
+	}
+	urlKey, originKey := redisURLKey(record.ShortPath), redisOriginKey(record.OriginalURL)
+
+	// Запись и обратный индекс пишутся одним MSETNX: сбой или обрыв соединения
+	// не оставляет индекс без записи, и откатывать нечего.
+	for attempt := 0; attempt < maxOriginAttempts; attempt++ {
+		ok, err := r.client.MSetNX(ctx, urlKey, value, originKey, record.ShortPath).Result()
+		if err != nil {
+			return fmt.Errorf("failed to create URL: %w", err)
+		}
+		if ok {
+			if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				r.queueIndexes(ctx, pipe, record)
+				return nil
+			}); err != nil {
+				return fmt.Errorf("failed to index URL: %w", err)
+			}
+			return nil
+		}
+
+		// Занят обратный индекс или короткий путь. Индекс удаленной или истекшей ссылки
+		// освобождается, и запись повторяется
+		existing, err := r.client.Get(ctx, originKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("failed to get existing short_path: %w", err)
+		}
+		if err == nil {
+			existing, err = r.activeOrigin(ctx, record.OriginalURL, existing)
+			if err != nil {
+				return err
+			}
+			if existing != "" {
+				return &ErrURLAlreadyExists{ShortPath: existing}
+			}
+			continue
+		}
+		taken, err := r.client.Exists(ctx, urlKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check short_path collision: %w", err)
+		}
+		if taken > 0 {
+			return &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+	}
+	return fmt.Errorf("failed to create URL: %w", errOriginChanged)
+}
+
+// CreateBatch читает обратный индекс и занятость коротких путей одним конвейером GET
+// и записывает новые записи и их обратный индекс одним MSETNX. Если между проверкой
+// и записью те же ключи занял параллельный запрос, MSETNX ничего не записывает,
+// и пачка проверяется заново: такие URL получают Existed, а занятый путь — ErrShortPathCollision.
+func (r *RedisStorage) CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	for attempt := 0; attempt < maxOriginAttempts; attempt++ {
+		results, values, created, err := r.planBatch(ctx, records)
+		if err != nil {
+			return nil, err
+		}
+		if len(created) == 0 {
+			return results, nil
+		}
+
+		ok, err := r.client.MSetNX(ctx, values...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create URLs: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, record := range created {
+				r.queueIndexes(ctx, pipe, record)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to index URLs: %w", err)
+		}
+		return results, nil
+	}
+	return nil, fmt.Errorf("failed to create URLs: %w", errOriginChanged)
+}
+
+// planBatch проверяет пачку по текущему состоянию Redis и возвращает результаты по элементам,
+// пары ключ-значение для MSETNX и записи, которые нужно создать.
+func (r *RedisStorage) planBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, []any, []URLRecord, error) {
+	urlCmds := make([]*redis.StringCmd, len(records))
+	originCmds := make([]*redis.StringCmd, len(records))
+	if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, record := range records {
+			urlCmds[i] = pipe.Get(ctx, redisURLKey(record.ShortPath))
+			originCmds[i] = pipe.Get(ctx, redisOriginKey(record.OriginalURL))
+		}
+		return nil
+	}); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, nil, nil, fmt.Errorf("failed to check short_path collision: %w", err)
+	}
+
+	results := make([]BatchItemResult, len(records))
+	var values []any
+	var created []URLRecord
+	pending := make(map[string]string, len(records))
+	pendingShorts := make(map[string]struct{}, len(records))
+	for i, record := range records {
+		existing, err := originCmds[i].Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, nil, nil, fmt.Errorf("failed to get existing short_path: %w", err)
+		}
+		if err == nil {
+			if existing, err = r.activeOrigin(ctx, record.OriginalURL, existing); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if existing != "" {
+			results[i] = BatchItemResult{ShortPath: existing, Existed: true}
+			continue
+		}
+		if short, ok := pending[record.OriginalURL]; ok {
+			results[i] = BatchItemResult{ShortPath: short, Existed: true}
+			continue
+		}
+
+		if _, err := decodeRedisRecord(record.ShortPath, urlCmds[i]); !errors.Is(err, ErrNotFound) {
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return nil, nil, nil, &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+		if _, ok := pendingShorts[record.ShortPath]; ok {
+			return nil, nil, nil, &ErrShortPathCollision{ShortPath: record.ShortPath}
+		}
+
+		value, err := json.Marshal(toKVRecord(record))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to encode URL: %w", err)
+		}
+		values = append(values,
+			redisURLKey(record.ShortPath), value,
+			redisOriginKey(record.OriginalURL), record.ShortPath)
+		pending[record.OriginalURL] = record.ShortPath
+		pendingShorts[record.ShortPath] = struct{}{}
+		results[i] = BatchItemResult{ShortPath: record.ShortPath}
+		created = append(created, record)
+	}
+	return results, values, created, nil
+}
+
+func (r *RedisStorage) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
+	if userID == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	shorts, err := r.client.SMembers(ctx, redisUserKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user URLs: %w", err)
+	}
+	loaded, err := r.getRecords(ctx, shorts)
+	if err != nil {
+		return nil, err
+	}
+	return collectUserURLs(recordsByShortPath(loaded), userID), nil
+}
+
+func (r *RedisStorage) DeleteURLs(ctx context.Context, items []DeleteItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	shorts := make([]string, 0, len(items))
+	for _, item := range items {
+		shorts = append(shorts, item.ShortPath)
+	}
+	loaded, err := r.getRecords(ctx, shorts)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.markDeleted(ctx, deletedRecords(recordsByShortPath(loaded), items))
+	return err
+}
+
+// DeleteExpired выбирает ссылки с истекшим сроком по индексу сроков и помечает их удаленными.
+func (r *RedisStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	shorts, err := r.client.ZRangeByScore(ctx, redisExpiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired URLs: %w", err)
+	}
+	loaded, err := r.getRecords(ctx, shorts)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.markDeleted(ctx, expiredRecords(recordsByShortPath(loaded), now))
+}
+
+func (r *RedisStorage) CountURLs(ctx context.Context) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	count, err := r.client.SCard(ctx, redisURLsKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count URLs: %w", err)
+	}
+	return int(count), nil
+}
+
+// CountUsers считает пользователей, у которых осталась хотя бы одна неудаленная ссылка:
+// множество ссылок пользователя пересекается с множеством неудаленных ссылок.
+func (r *RedisStorage) CountUsers(ctx context.Context) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	users, err := r.client.SMembers(ctx, redisUsersKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	cmds, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range users {
+			pipe.SInter(ctx, redisUserKey(userID), redisURLsKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	count := 0
+	for _, cmd := range cmds {
+		if len(cmd.(*redis.StringSliceCmd).Val()) > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Close закрывает соединения с Redis.
+func (r *RedisStorage) Close() error {
+	return r.client.Close()
+}
+
+// activeOrigin проверяет ссылку short, на которую указывает обратный индекс originalURL,
+// и возвращает короткий путь активной ссылки на этот URL. Индекс удаленной, истекшей
+// или отсутствующей ссылки снимается, тогда возвращается пустая строка. Запись и индекс
+// создаются одним MSETNX, поэтому индекс без записи остается только от сбоя старой версии.
+func (r *RedisStorage) activeOrigin(ctx context.Context, originalURL, short string) (string, error) {
+	for attempt := 0; attempt < maxOriginAttempts; attempt++ {
+		record, err := r.getRecord(ctx, short)
+		if err == nil && record.Active(time.Now()) {
+			return short, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+
+		released, err := r.releaseOrigin(ctx, originalURL, short)
+		if err != nil {
+			return "", err
+		}
+		if released {
+			return "", nil
+		}
+		short, err = r.client.Get(ctx, redisOriginKey(originalURL)).Result()
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get existing short_path: %w", err)
+		}
+	}
+	return "", fmt.Errorf("failed to check existing short_path: %w", errOriginChanged)
+}
+
+// releaseOrigin удаляет обратный индекс originalURL, только если он указывает на short.
+// Сообщает, был ли индекс удален.
+func (r *RedisStorage) releaseOrigin(ctx context.Context, originalURL, short string) (bool, error) {
+	key := redisOriginKey(originalURL)
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if current != short {
+			return errOriginChanged
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, errOriginChanged) || errors.Is(err, redis.TxFailedErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update original_url index: %w", err)
+	}
+	return true, nil
+}
+
+// queueIndexes добавляет в конвейер обновление индексов для новой ссылки.
+func (r *RedisStorage) queueIndexes(ctx context.Context, pipe redis.Pipeliner, record URLRecord) {
+	pipe.SAdd(ctx, redisURLsKey, record.ShortPath)
+	if record.UserID != "" {
+		pipe.SAdd(ctx, redisUserKey(record.UserID), record.ShortPath)
+		pipe.SAdd(ctx, redisUsersKey, record.UserID)
+	}
+	if record.ExpiresAt != nil {
+		pipe.ZAdd(ctx, redisExpiryKey, redis.Z{Score: float64(record.ExpiresAt.Unix()), Member: record.ShortPath})
+	}
+}
+
+// markDeleted сохраняет помеченные удаленными записи и убирает их из индексов,
+// включая обратный индекс original_url.
+func (r *RedisStorage) markDeleted(ctx context.Context, records []URLRecord) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, record := range records {
+			value, err := json.Marshal(toKVRecord(record))
+			if err != nil {
+				return fmt.Errorf("failed to encode URL: %w", err)
+			}
+			pipe.SetXX(ctx, redisURLKey(record.ShortPath), value, 0)
+			pipe.SRem(ctx, redisURLsKey, record.ShortPath)
+			pipe.ZRem(ctx, redisExpiryKey, record.ShortPath)
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("failed to delete URLs: %w", err)
+	}
+
+	// URL удаленных ссылок можно сократить заново
+	for _, record := range records {
+		if _, err := r.releaseOrigin(ctx, record.OriginalURL, record.ShortPath); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(records)), nil
+}
+
+func (r *RedisStorage) getRecord(ctx context.Context, short string) (URLRecord, error) {
+	return decodeRedisRecord(short, r.client.Get(ctx, redisURLKey(short)))
+}
+
+// getRecords загружает записи одним MGET, отсутствующие ключи пропускаются.
+func (r *RedisStorage) getRecords(ctx context.Context, shorts []string) ([]URLRecord, error) {
+	if len(shorts) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(shorts))
+	for _, short := range shorts {
+		keys = append(keys, redisURLKey(short))
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URLs: %w", err)
+	}
+
+	records := make([]URLRecord, 0, len(values))
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		record, err := decodeKVRecord(shorts[i], []byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// decodeRedisRecord разбирает ответ GET, отсутствие ключа превращается в ErrNotFound.
+func decodeRedisRecord(short string, cmd *redis.StringCmd) (URLRecord, error) {
+	raw, err := cmd.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return URLRecord{}, ErrNotFound
+	}
+	if err != nil {
+		return URLRecord{}, fmt.Errorf("failed to get URL: %w", err)
+	}
+	return decodeKVRecord(short, raw)
+}
+
+func recordsByShortPath(records []URLRecord) map[string]URLRecord {
+	data := make(map[string]URLRecord, len(records))
+	for _, record := range records {
+		data[record.ShortPath] = record
+	}
+	return data
+}
@@ -1,17 +1,21 @@
 package storage
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"sync"
+	"time"
 )
 
 var ErrNotFound = errors.New("url not found")
 
+// ErrDeleted возвращается при обращении к удаленной пользователем ссылке.
+var ErrDeleted = errors.New("url deleted")
+
+// ErrExpired возвращается при обращении к ссылке с истекшим сроком действия.
+var ErrExpired = errors.New("url expired")
+
 // ErrURLAlreadyExists представляет ошибку, когда URL уже существует в базе данных
 type ErrURLAlreadyExists struct {
 	ShortPath string
@@ -21,138 +25,112 @@ func (e *ErrURLAlreadyExists) Error() string {
 	return fmt.Sprintf("url already exists with short_path: %s", e.ShortPath)
 }
 
-type BatchItem struct {
+// ErrShortPathCollision возвращается, когда короткий путь уже занят другим URL
+type ErrShortPathCollision struct {
 	ShortPath string
-	FullURL   string
 }
 
-type URLStorage interface {
-	Get(short string) (string, error)
-	Create(short, full string) error
-	CreateBatch(ctx context.Context, items []BatchItem) error
+func (e *ErrShortPathCollision) Error() string {
+	return fmt.Sprintf("short_path %s is already taken by another url", e.ShortPath)
 }
 
-type Storage struct {
-	mu       sync.RWMutex
-	data     map[string]string
-	filePath string
+// URLRecord описывает сохраненную короткую ссылку и ее владельца.
+type URLRecord struct {
+	ShortPath   string
+	OriginalURL string
+	UserID      string
+	IsDeleted   bool
+	// ExpiresAt момент, после которого ссылка перестает работать. nil — бессрочная ссылка.
+	ExpiresAt *time.Time
 }
 
-func NewStorage(filePath string) (*Storage, error) {
-	if filePath == "" {
-		return nil, fmt.Errorf("file path cannot be empty")
-	}
-
-	data, err := readLines(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("read urls from file error: %w", err)
-	}
-
-	return &Storage{
-		data:     data,
-		filePath: filePath,
-	}, nil
+// Expired сообщает, истек ли срок действия ссылки к моменту now.
+func (r URLRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
 }
 
-func readLines(filePath string) (map[string]string, error) {
-	file, err := os.OpenFile(filePath, os.O_CREATE, 0777)
-	if err != nil {
-		return nil, err
-	}
-
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
-
-	scanner := bufio.NewScanner(file)
-	res := make(map[string]string)
-
-	if ok := scanner.Scan(); !ok {
-		return res, nil
-	}
-
-	err = json.Unmarshal([]byte(scanner.Text()), &res)
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
+// Active сообщает, что ссылка не удалена и действует в момент now. Только активная ссылка
+// занимает свой original_url: удаленный или истекший URL можно сократить заново.
+func (r URLRecord) Active(now time.Time) bool {
+	return !r.IsDeleted && !r.Expired(now)
 }
 
-func (s *Storage) Create(id, url string) error {
-	s.mu.Lock()
-	s.data[id] = url
-	dataCopy := make(map[string]string)
-	for k, v := range s.data {
-		dataCopy[k] = v
-	}
-	s.mu.Unlock()
-
-	file, err := os.OpenFile(s.filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("open file error: %w", err)
-	}
-
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
-
-	data, err := json.Marshal(dataCopy)
-	if err != nil {
-		return fmt.Errorf("serialize url error: %w", err)
-	}
-
-	_, err = file.WriteString(string(data))
-	if err != nil {
-		return fmt.Errorf("write url to file error: %w", err)
-	}
-
-	return nil
+// kvRecord представление URLRecord в key-value хранилищах (Redis, bbolt).
+// Короткий путь хранится в ключе и в значение не входит.
+type kvRecord struct {
+	OriginalURL string     `json:"original_url"`
+	UserID      string     `json:"user_id,omitempty"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 }
 
-func (s *Storage) Get(id string) (string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	url, ok := s.data[id]
-	if !ok {
-		return "", ErrNotFound
+func toKVRecord(record URLRecord) kvRecord {
+	return kvRecord{
+		OriginalURL: record.OriginalURL,
+		UserID:      record.UserID,
+		IsDeleted:   record.IsDeleted,
+		ExpiresAt:   record.ExpiresAt,
 	}
-
-	return url, nil
 }
 
-func (s *Storage) CreateBatch(ctx context.Context, items []BatchItem) error {
-	s.mu.Lock()
-	// Обновляем data map атомарно
-	for _, item := range items {
-		s.data[item.ShortPath] = item.FullURL
+func decodeKVRecord(short string, raw []byte) (URLRecord, error) {
+	var stored kvRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return URLRecord{}, fmt.Errorf("failed to decode URL %s: %w", short, err)
 	}
-	dataCopy := make(map[string]string)
-	for k, v := range s.data {
-		dataCopy[k] = v
-	}
-	s.mu.Unlock()
+	return stored.toURLRecord(short), nil
+}
 
-	// Записываем весь файл за одну операцию
-	file, err := os.OpenFile(s.filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("open file error: %w", err)
+func (r kvRecord) toURLRecord(short string) URLRecord {
+	return URLRecord{
+		ShortPath:   short,
+		OriginalURL: r.OriginalURL,
+		UserID:      r.UserID,
+		IsDeleted:   r.IsDeleted,
+		ExpiresAt:   r.ExpiresAt,
 	}
+}
 
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
-
-	data, err := json.Marshal(dataCopy)
-	if err != nil {
-		return fmt.Errorf("serialize url error: %w", err)
-	}
+// DeleteItem описывает запрос пользователя на удаление одной ссылки.
+type DeleteItem struct {
+	UserID    string
+	ShortPath string
+}
 
-	_, err = file.WriteString(string(data))
-	if err != nil {
-		return fmt.Errorf("write url to file error: %w", err)
-	}
+// BatchItemResult итог сохранения одной записи пачки.
+type BatchItemResult struct {
+	// ShortPath короткий путь, по которому доступен URL записи.
+	ShortPath string
+	// Existed сообщает, что URL уже был сокращен и новая запись не создавалась.
+	Existed bool
+}
 
-	return nil
+// URLStorage хранилище коротких ссылок. Все методы принимают контекст запроса,
+// чтобы отмена и дедлайны доходили до базы данных.
+//
+// original_url уникален только среди активных ссылок: пока ссылка не удалена и не истекла,
+// повторное сокращение того же URL возвращает ее короткий путь, после удаления или истечения
+// URL можно сократить заново. Все реализации соблюдают это одинаково.
+type URLStorage interface {
+	Get(ctx context.Context, short string) (string, error)
+	// GetRecord возвращает запись ссылки целиком с теми же ошибками, что и Get.
+	GetRecord(ctx context.Context, short string) (URLRecord, error)
+	// Create сохраняет ссылку. Если URL уже сокращен, возвращает *ErrURLAlreadyExists
+	// с существующим коротким путем, если short_path занят — *ErrShortPathCollision.
+	Create(ctx context.Context, record URLRecord) error
+	// CreateBatch сохраняет пачку атомарно и возвращает итог по каждой записи в порядке records.
+	// Для уже сокращенных URL, в том числе повторяющихся внутри пачки, запись не создается,
+	// а возвращается существующий короткий путь. Занятый short_path приводит
+	// к *ErrShortPathCollision, и пачка не сохраняется целиком.
+	CreateBatch(ctx context.Context, records []URLRecord) ([]BatchItemResult, error)
+	GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error)
+	// DeleteURLs помечает ссылки удаленными. Ссылки других пользователей не затрагиваются.
+	DeleteURLs(ctx context.Context, items []DeleteItem) error
+	// DeleteExpired помечает удаленными ссылки, срок действия которых истек к моменту now.
+	// Возвращает количество затронутых ссылок.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+	// CountURLs возвращает количество сокращенных ссылок, не считая удаленных.
+	CountURLs(ctx context.Context) (int, error)
+	// CountUsers возвращает количество пользователей, у которых есть хотя бы одна неудаленная ссылка.
+	CountUsers(ctx context.Context) (int, error)
 }
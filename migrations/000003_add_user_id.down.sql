@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_id;
+ALTER TABLE urls DROP COLUMN IF EXISTS user_id;
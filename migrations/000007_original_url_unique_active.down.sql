@@ -0,0 +1,3 @@
+-- Не применится, если после удаления ссылки тот же URL был сокращен заново
+DROP INDEX IF EXISTS idx_original_url_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url_unique ON urls(original_url);
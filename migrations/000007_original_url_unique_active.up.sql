@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_original_url_unique;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url_active ON urls(original_url) WHERE NOT is_deleted;